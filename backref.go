@@ -0,0 +1,85 @@
+package stateparser
+
+import (
+	"fmt"
+)
+
+// CaptureStore is implemented by readers that can hold named captures for
+// the duration of a parse. Named stores the text of a match in it, and
+// BackReference reads it back. Captures are part of the reader's state,
+// so a capture made by an alternative that is later backtracked disappears
+// with it.
+type CaptureStore interface {
+	StoreCapture(name, value string)
+	GetCapture(name string) (string, bool)
+}
+
+// namedCapture is an immutable list of captures, newest first, so a reader
+// state can hold on to the captures as they were without copying.
+type namedCapture struct {
+	name, value string
+	next        *namedCapture
+}
+
+func (nc *namedCapture) get(name string) (string, bool) {
+	for ; nc != nil; nc = nc.next {
+		if nc.name == name {
+			return nc.value, true
+		}
+	}
+	return "", false
+}
+
+func captureStore(sr StateReader) (CaptureStore, bool) {
+	for {
+		if cs, ok := sr.(CaptureStore); ok {
+			return cs, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+// Named matches g and stores the text it consumed as the capture name, for a
+// later BackReference, returning g's match unchanged. Only Named stores
+// captures, so grammars that don't use back-references pay nothing for them.
+// It requires a reader that records captures, such as StringReader.
+func Named(name string, g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		cs, ok := captureStore(sr)
+		if !ok {
+			return nil, fmt.Errorf("Named requires a reader that records captures")
+		}
+		cr := &captureReader{StateReader: sr}
+		m, err := g(cr)
+		if err != nil {
+			return nil, err
+		}
+		cs.StoreCapture(name, cr.buf.String())
+		return m, nil
+	}
+}
+
+// BackReference matches the same text as the most recent match captured by
+// Named as name, as in <foo>...</foo> where the closing name must repeat the
+// opening one. It requires a reader that records captures, such as
+// StringReader.
+func BackReference(name string) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		cs, ok := captureStore(sr)
+		if !ok {
+			return nil, fmt.Errorf("BackReference requires a reader that records captures")
+		}
+		text, ok := cs.GetCapture(name)
+		if !ok {
+			return nil, fmt.Errorf("Nothing captured as %q", name)
+		}
+		if text == "" {
+			return text, nil
+		}
+		return Lit(text)(sr)
+	}
+}
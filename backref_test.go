@@ -0,0 +1,66 @@
+package stateparser
+
+import "testing"
+
+func TestBackReference(t *testing.T) {
+	name := Capture(Many1(Set("a-z")))
+	element := And(
+		Lit("<"), Named("tag", name), Lit(">"),
+		Capture(Many(NotSet("<"))),
+		Lit("</"), BackReference("tag"), Lit(">"),
+	)
+	m, err := Parse(element, "<foo>body</foo>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := String(m); got != "<foo>body</foo>" {
+		t.Errorf("match = %q", got)
+	}
+	if _, err := Parse(element, "<foo>body</bar>"); err == nil {
+		t.Error("mismatched close tag was accepted")
+	}
+}
+
+func TestTagDoesNotCapture(t *testing.T) {
+	g := And(Tag("tag", Lit("foo")), BackReference("tag"))
+	if _, err := Parse(g, "foofoo"); err == nil {
+		t.Error("Tag stored a capture")
+	}
+}
+
+func TestCaptureRollback(t *testing.T) {
+	word := Capture(Many1(Set("a-z")))
+	g := Or(
+		And(Named("x", word), Lit("!")),
+		And(word, Lit("?")),
+	)
+	sr := NewStringReader("abc?")
+	if _, err := g(sr); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := sr.GetCapture("x"); ok {
+		t.Errorf("capture from the failed branch survived as %q", v)
+	}
+
+	sr = NewStringReader("abc!")
+	if _, err := g(sr); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := sr.GetCapture("x"); !ok || v != "abc" {
+		t.Errorf("capture = %q, %v, want %q", v, ok, "abc")
+	}
+
+	// A later capture under the same name shadows the earlier one until
+	// it is backtracked over.
+	sr = NewStringReader("")
+	sr.StoreCapture("x", "old")
+	state := sr.State()
+	sr.StoreCapture("x", "new")
+	if v, _ := sr.GetCapture("x"); v != "new" {
+		t.Errorf("GetCapture = %q, want %q", v, "new")
+	}
+	sr.RestoreState(state)
+	if v, _ := sr.GetCapture("x"); v != "old" {
+		t.Errorf("GetCapture after restore = %q, want %q", v, "old")
+	}
+}
@@ -0,0 +1,58 @@
+package stateparser
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+var hexDigits = Capture(Many1(Set("0-9a-fA-F")))
+
+// base64Text matches a run of enc's alphabet, followed by up to two padding
+// characters if enc uses padding. The encoding doesn't expose its alphabet,
+// so it is recovered by encoding each 6-bit value in turn.
+func base64Text(enc *base64.Encoding) Grammar {
+	var alphabet [256]bool
+	for i := 0; i < 64; i++ {
+		alphabet[enc.EncodeToString([]byte{byte(i << 2)})[0]] = true
+	}
+	digit := satisfy("base64 digit", func(r rune) bool {
+		return r < 256 && alphabet[r]
+	})
+	g := Many1(digit)
+	if padded := enc.EncodeToString([]byte{0}); len(padded) == 4 {
+		g = And(g, Mult(0, 2, Lit(padded[3:])))
+	}
+	return Capture(g)
+}
+
+// decoded matches text with g and decodes it with decode, restoring the
+// reader if decoding fails.
+func decoded(g Grammar, decode func(string) ([]byte, error)) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := g(sr)
+		if err != nil {
+			return nil, err
+		}
+		b, err := decode(m.(string))
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return b, nil
+	}
+}
+
+// HexBytes matches a run of hex digits and returns the bytes they encode.
+// An odd number of digits is an error.
+func HexBytes() Grammar {
+	return decoded(hexDigits, hex.DecodeString)
+}
+
+// Base64Bytes matches a run of base64 text and returns the bytes it encodes
+// under enc. Only enc's own alphabet and padding are consumed, so a '-' or
+// '_' after standard base64 is left for what follows. Text that enc can't
+// decode, such as text of an invalid length, is an error.
+func Base64Bytes(enc *base64.Encoding) Grammar {
+	return decoded(base64Text(enc), enc.DecodeString)
+}
@@ -0,0 +1,58 @@
+package stateparser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestHexBytes(t *testing.T) {
+	sr := NewStringReader("DEADbeef01 rest")
+	m, err := HexBytes()(sr)
+	if err != nil || !bytes.Equal(m.([]byte), []byte{0xde, 0xad, 0xbe, 0xef, 0x01}) || sr.Pos() != 10 {
+		t.Errorf("HexBytes = %x, %v up to %d", m, err, sr.Pos())
+	}
+	for _, input := range []string{"abc", "xyz", ""} {
+		sr := NewStringReader(input)
+		if _, err := HexBytes()(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("HexBytes on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+}
+
+func TestBase64Bytes(t *testing.T) {
+	tests := []struct {
+		enc   *base64.Encoding
+		input string
+		want  string
+	}{
+		{base64.StdEncoding, "aGVsbG8gd29ybGQ=", "hello world"},
+		{base64.StdEncoding, "+/8=", "\xfb\xff"},
+		{base64.URLEncoding, "-_8=", "\xfb\xff"},
+		{base64.RawStdEncoding, "aGk", "hi"},
+	}
+	for _, tt := range tests {
+		m, err := Parse(Base64Bytes(tt.enc), tt.input+" ")
+		if err != nil || string(m.([]byte)) != tt.want {
+			t.Errorf("Base64Bytes on %q = %q, %v, want %q", tt.input, m, err, tt.want)
+		}
+	}
+	for _, input := range []string{"aGVsbG8", "aGk", "!!!!"} {
+		sr := NewStringReader(input)
+		if _, err := Base64Bytes(base64.StdEncoding)(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("Base64Bytes on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+	// Characters outside the encoding's alphabet, and padding an unpadded
+	// encoding doesn't use, are left unconsumed.
+	if _, err := Parse(And(Base64Bytes(base64.StdEncoding), Lit("-x")), "aGk=-x"); err != nil {
+		t.Errorf("Base64Bytes swallowed a following '-': %v", err)
+	}
+	if _, err := Parse(And(Base64Bytes(base64.RawURLEncoding), Lit("+")), "_-8+"); err != nil {
+		t.Errorf("Base64Bytes swallowed a following '+': %v", err)
+	}
+	sr := NewStringReader("aGk=")
+	if m, err := Base64Bytes(base64.RawStdEncoding)(sr); err != nil || string(m.([]byte)) != "hi" || sr.Pos() != 3 {
+		t.Errorf("RawStdEncoding on padded text = %q, %v at %d, want %q at 3", m, err, sr.Pos(), "hi")
+	}
+}
@@ -0,0 +1,64 @@
+package stateparser
+
+import (
+	"sort"
+)
+
+type boolConfig struct {
+	words      map[string]bool
+	ignoreCase bool
+}
+
+// A BoolOption configures Bool.
+type BoolOption func(*boolConfig)
+
+// BoolSpelling accepts t as true and f as false. Passing any BoolSpelling
+// replaces the default "true"/"false" spelling, so include it again if it
+// should still be accepted.
+func BoolSpelling(t, f string) BoolOption {
+	return func(bc *boolConfig) {
+		bc.words[t] = true
+		bc.words[f] = false
+	}
+}
+
+// BoolIgnoreCase makes Bool match its spellings case-insensitively.
+func BoolIgnoreCase() BoolOption {
+	return func(bc *boolConfig) {
+		bc.ignoreCase = true
+	}
+}
+
+// Bool matches a boolean literal, by default "true" or "false", and returns
+// it as a bool. If several spellings match, the longest wins.
+func Bool(opts ...BoolOption) Grammar {
+	bc := &boolConfig{words: map[string]bool{}}
+	for _, opt := range opts {
+		opt(bc)
+	}
+	if len(bc.words) == 0 {
+		BoolSpelling("true", "false")(bc)
+	}
+	words := make([]string, 0, len(bc.words))
+	for w := range bc.words {
+		words = append(words, w)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	alts := make([]Grammar, len(words))
+	for i, w := range words {
+		v := bc.words[w]
+		lit := Lit(w)
+		if bc.ignoreCase {
+			lit = LitI(w, FoldUnicode)
+		}
+		alts[i] = Node(lit, func(interface{}) (interface{}, error) {
+			return v, nil
+		})
+	}
+	return Label("boolean", Or(alts...))
+}
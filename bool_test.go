@@ -0,0 +1,42 @@
+package stateparser
+
+import (
+	"testing"
+)
+
+func TestBool(t *testing.T) {
+	custom := Bool(BoolSpelling("yes", "no"), BoolSpelling("on", "off"), BoolIgnoreCase())
+	tests := []struct {
+		g     Grammar
+		input string
+		want  interface{}
+		pos   int
+	}{
+		{Bool(), "true", true, 4},
+		{Bool(), "false,", false, 5},
+		{custom, "YES", true, 3},
+		{custom, "Off", false, 3},
+		{custom, "on", true, 2},
+		{custom, "no", false, 2},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := tt.g(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.pos {
+			t.Errorf("Bool on %q = %v, %v up to %d, want %v up to %d", tt.input, m, err, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, tt := range []struct {
+		g     Grammar
+		input string
+	}{
+		{Bool(), "True"},
+		{Bool(), "yes"},
+		{custom, "true"},
+		{custom, "maybe"},
+	} {
+		if m, err := Parse(tt.g, tt.input); err == nil {
+			t.Errorf("Bool matched %q as %v", tt.input, m)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package stateparser
+
+import (
+	"bytes"
+)
+
+type captureReader struct {
+	StateReader
+	buf bytes.Buffer
+}
+
+type captureState struct {
+	inner interface{}
+	n     int
+}
+
+func (cr *captureReader) unwrap() StateReader {
+	return cr.StateReader
+}
+
+func (cr *captureReader) ReadRune() (rune, int, error) {
+	r, size, err := cr.StateReader.ReadRune()
+	if err == nil {
+		cr.buf.WriteRune(r)
+	}
+	return r, size, err
+}
+
+func (cr *captureReader) State() interface{} {
+	return captureState{cr.StateReader.State(), cr.buf.Len()}
+}
+
+func (cr *captureReader) RestoreState(state interface{}) {
+	cs := state.(captureState)
+	cr.StateReader.RestoreState(cs.inner)
+	cr.buf.Truncate(cs.n)
+}
+
+// Capture runs g and returns the text it consumed as a single string,
+// discarding g's own match. Runes are written to a buffer as they are read
+// (and truncated again when g backtracks), so the text doesn't have to be
+// rebuilt from g's match with String. Directly on a StringReader no buffer
+// is needed at all: the text is sliced out of the input. g still builds its
+// match, which is then thrown away; to avoid that cost for a long run, use
+// a repetition that doesn't collect, as in Capture(SkipMany(g)).
+func Capture(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		if s, ok := sr.(*StringReader); ok {
+			start := s.pos
+			if _, err := g(sr); err != nil {
+				return nil, err
+			}
+			return s.src[start:s.pos], nil
+		}
+		cr := &captureReader{StateReader: sr}
+		_, err := g(cr)
+		if err != nil {
+			return nil, err
+		}
+		return cr.buf.String(), nil
+	}
+}
@@ -0,0 +1,50 @@
+package stateparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	g := Capture(And(Many(Set("a-z")), Optional(And(Lit("-"), Lit("!")))))
+	// Under Named, Capture runs on a wrapping reader rather than the
+	// StringReader itself and has to buffer what it reads.
+	for _, g := range []Grammar{g, Named("x", g)} {
+		sr := NewStringReader("abc-x")
+		m, err := g(sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The Optional reads the '-' before failing on 'x'; its rune must
+		// not be left in the captured text.
+		if m != "abc" || sr.Pos() != 3 {
+			t.Errorf("Capture = %q up to %d, want %q up to 3", m, sr.Pos(), "abc")
+		}
+	}
+}
+
+var token = strings.Repeat("abcdefghij", 1<<20/10)
+
+func BenchmarkCapture(b *testing.B) {
+	g := Capture(SkipMany(Set("a-z")))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(token)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(g, token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCaptureString(b *testing.B) {
+	g := Node(Many(Set("a-z")), func(m interface{}) (interface{}, error) {
+		return String(m), nil
+	})
+	b.ReportAllocs()
+	b.SetBytes(int64(len(token)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(g, token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package stateparser
+
+// The methods below mirror the package-level combinators so grammars can be
+// built by chaining, e.g. Lit("a").Then(Lit("b")).Or(Lit("c")).Many().
+
+func (g Grammar) Then(next ...Grammar) Grammar {
+	return And(append([]Grammar{g}, next...)...)
+}
+
+func (g Grammar) Or(alts ...Grammar) Grammar {
+	return Or(append([]Grammar{g}, alts...)...)
+}
+
+func (g Grammar) Many() Grammar {
+	return Many(g)
+}
+
+func (g Grammar) Opt() Grammar {
+	return Optional(g)
+}
+
+func (g Grammar) Map(node func(interface{}) (interface{}, error)) Grammar {
+	return Node(g, node)
+}
+
+func (g Grammar) Tag(tag string) Grammar {
+	return Tag(tag, g)
+}
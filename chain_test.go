@@ -0,0 +1,28 @@
+package stateparser
+
+import (
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	g := Lit("a").Then(Lit("b")).Or(Lit("c")).Many().Tag("run")
+	m, err := Parse(g, "abcab!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, ok := m.(TaggedMatch)
+	if !ok || tm.Tag != "run" || String(tm) != "abcab" {
+		t.Errorf("chained grammar = %#v", m)
+	}
+
+	count := Lit("x").Many().Map(func(m interface{}) (interface{}, error) {
+		return len(m.([]interface{})), nil
+	})
+	g = Lit("-").Opt().Then(count)
+	if m, err := Parse(g, "-xx"); err != nil || String(m.([]interface{})[0]) != "-" || m.([]interface{})[1] != 2 {
+		t.Errorf("Opt/Map on %q = %#v, %v", "-xx", m, err)
+	}
+	if m, err := Parse(g, "xxx"); err != nil || String(m.([]interface{})[0]) != "" || m.([]interface{})[1] != 3 {
+		t.Errorf("Opt/Map on %q = %#v, %v", "xxx", m, err)
+	}
+}
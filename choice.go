@@ -0,0 +1,109 @@
+package stateparser
+
+import "fmt"
+
+// choice records one run of a Commitable: the alternative it started from,
+// the one that matched (-1 if none did) and how many there were.
+type choice struct {
+	start, index, alts int
+}
+
+// choiceReader is installed by Disambiguate. It forces the Commitables of a
+// re-parse to start from given alternatives and logs the choices they make,
+// in the order they run.
+type choiceReader struct {
+	StateReader
+	forced []int
+	made   []choice
+}
+
+func (cr *choiceReader) unwrap() StateReader {
+	return cr.StateReader
+}
+
+func choiceLog(sr StateReader) (*choiceReader, bool) {
+	for {
+		if cr, ok := sr.(*choiceReader); ok {
+			return cr, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+// Commitable is like Or, but its choice is only tentative: if it runs inside
+// Disambiguate and the parse later fails, even outside the Commitable, the
+// parse is run again with the Commitable moving on to its next alternative.
+// Outside Disambiguate it behaves exactly like Or.
+func Commitable(gs ...Grammar) Grammar {
+	or := Or(gs...)
+	return func(sr StateReader) (interface{}, error) {
+		cr, ok := choiceLog(sr)
+		if !ok {
+			return or(sr)
+		}
+		n := len(cr.made)
+		start := 0
+		if n < len(cr.forced) {
+			start = cr.forced[n]
+		}
+		cr.made = append(cr.made, choice{start: start, index: -1, alts: len(gs)})
+		var lastErr error
+		for i := start; i < len(gs); i++ {
+			state := sr.State()
+			m, err := gs[i](sr)
+			if err == nil {
+				cr.made[n].index = i
+				return m, nil
+			}
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("No alternatives remain")
+		}
+		return nil, lastErr
+	}
+}
+
+// Disambiguate runs g, and if it fails non-fatally, runs it again with the
+// most recent Commitable that still has untried alternatives moving on to
+// its next one, until g matches or every combination of choices has been
+// tried. Since every combination may be tried, it is meant for grammars
+// where late rejection is rare; MaxSteps bounds the work on untrusted input.
+func Disambiguate(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		cr := &choiceReader{StateReader: sr}
+		for {
+			cr.made = cr.made[:0]
+			m, err := g(cr)
+			if err == nil {
+				return m, nil
+			}
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			k := len(cr.made) - 1
+			for k >= 0 && (cr.made[k].index < 0 || cr.made[k].index+1 >= cr.made[k].alts) {
+				k--
+			}
+			if k < 0 {
+				return nil, err
+			}
+			forced := make([]int, k+1)
+			for i := 0; i < k; i++ {
+				forced[i] = cr.made[i].start
+			}
+			forced[k] = cr.made[k].index + 1
+			cr.forced = forced
+		}
+	}
+}
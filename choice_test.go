@@ -0,0 +1,30 @@
+package stateparser
+
+import (
+	"testing"
+)
+
+func TestCommitable(t *testing.T) {
+	g := And(Commitable(Lit("ab"), Lit("a")), Lit("bc"))
+	// Or commits to "ab", after which "bc" can't match.
+	if _, err := Parse(g, "abc"); err == nil {
+		t.Fatal("matched without Disambiguate")
+	}
+	m, err := Parse(Disambiguate(g), "abc")
+	if err != nil || String(m) != "abc" || m.([]interface{})[0] != "a" {
+		t.Errorf("Disambiguate = %#v, %v, want the second alternative", m, err)
+	}
+
+	// The later constraint can reject a choice made by an earlier
+	// Commitable as well as the last one.
+	word := Commitable(Lit("xy"), Lit("x"))
+	g = And(word, Commitable(Lit("yz"), Lit("y")), Lit("!"))
+	m, err = Parse(Disambiguate(g), "xyz!")
+	if err != nil || String(m) != "xyz!" || m.([]interface{})[0] != "x" || m.([]interface{})[1] != "yz" {
+		t.Errorf("Disambiguate over two choices = %#v, %v", m, err)
+	}
+	sr := NewStringReader("xyq")
+	if _, err := Disambiguate(g)(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("Disambiguate with no working choice = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
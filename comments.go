@@ -0,0 +1,64 @@
+package stateparser
+
+// Comment is a comment collected by CollectComments.
+type Comment struct {
+	Text string
+	Span Span
+}
+
+// CommentCollector is implemented by readers that can gather comments
+// during a parse. Like captures, collected comments are part of the reader's
+// state and are dropped when the reader backtracks past them.
+type CommentCollector interface {
+	AddComment(Comment)
+	Comments() []Comment
+}
+
+// commentList is an immutable list of comments, newest first.
+type commentList struct {
+	comment Comment
+	next    *commentList
+}
+
+func (cl *commentList) slice() []Comment {
+	n := 0
+	for c := cl; c != nil; c = c.next {
+		n++
+	}
+	cs := make([]Comment, n)
+	for c := cl; c != nil; c = c.next {
+		n--
+		cs[n] = c.comment
+	}
+	return cs
+}
+
+func commentCollector(sr StateReader) (CommentCollector, bool) {
+	for {
+		if cc, ok := sr.(CommentCollector); ok {
+			return cc, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+// CollectComments matches comment and returns nil, so the comment is
+// skipped by the surrounding grammar, but records its text and span with the
+// reader if it implements CommentCollector.
+func CollectComments(comment Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		start := pos(sr)
+		m, err := comment(sr)
+		if err != nil {
+			return nil, err
+		}
+		if cc, ok := commentCollector(sr); ok {
+			cc.AddComment(Comment{Text: String(m), Span: Span{Start: start, End: pos(sr)}})
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,37 @@
+package stateparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollectComments(t *testing.T) {
+	comment := CollectComments(And(Lit("#"), Many(NotSet("\n"))))
+	skip := Many(Or(Ignore(Set(" \n")), comment))
+	stmt := And(skip, Capture(Many1(Set("a-z"))))
+	g := And(Many(stmt), skip)
+
+	sr := NewStringReader("# head\nfoo # one\nbar\n#two\n")
+	m, err := g(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := String(m); got != "foobar" {
+		t.Errorf("match = %q, want the comments skipped", got)
+	}
+	want := []Comment{
+		{"# head", Span{0, 6}},
+		{"# one", Span{11, 16}},
+		{"#two", Span{21, 25}},
+	}
+	if got := sr.Comments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Comments = %v, want %v", got, want)
+	}
+
+	// Comments read by an alternative that fails are dropped with it.
+	sr = NewStringReader("#x\n!")
+	Or(And(comment, Lit("\n"), Lit("?")), Lit("#"))(sr)
+	if got := sr.Comments(); len(got) != 0 {
+		t.Errorf("Comments after backtracking = %v", got)
+	}
+}
@@ -0,0 +1,87 @@
+package stateparser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Diagnostics describes a failed parse for reporting to a user.
+type Diagnostics struct {
+	Err error
+	// Pos is the furthest byte offset the parse reached, and Line and
+	// Column (both counting from 1, Column in runes) its location.
+	Pos          int
+	Line, Column int
+	// Expected lists the labels that failed at Pos.
+	Expected []string
+	// Snippet is the line of input containing Pos, followed by a line with a
+	// caret under Pos.
+	Snippet string
+}
+
+func (d *Diagnostics) String() string {
+	return fmt.Sprintf("%d:%d: %s\n%s", d.Line, d.Column, d.Err, d.Snippet)
+}
+
+// expectationRecorder is implemented by readers that remember which labels
+// failed at the furthest position reached, for ParseDiag.
+type expectationRecorder interface {
+	expect(name string, pos int)
+}
+
+func recordExpected(sr StateReader, name string, pos int) {
+	for {
+		if er, ok := sr.(expectationRecorder); ok {
+			er.expect(name, pos)
+			return
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return
+		}
+		sr = w.unwrap()
+	}
+}
+
+// ParseDiag is like Parse, but on failure returns Diagnostics locating the
+// error at the furthest position reached, with the labels expected there and
+// a snippet of the input. On success the Diagnostics are nil.
+func ParseDiag(g Grammar, input string, opts ...Option) (interface{}, *Diagnostics) {
+	sr := NewStringReader(input, opts...)
+	if err := sr.checkSize(); err != nil {
+		return nil, &Diagnostics{Err: err, Line: 1, Column: 1}
+	}
+	m, err := g(sr)
+	if err == nil {
+		return m, nil
+	}
+	p := sr.Furthest()
+	lineStart := strings.LastIndexByte(input[:p], '\n') + 1
+	lineEnd := strings.IndexByte(input[p:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(input)
+	} else {
+		lineEnd += p
+	}
+	line := strings.TrimSuffix(input[lineStart:lineEnd], "\r")
+	caret := []rune{}
+	for _, r := range input[lineStart:p] {
+		if r == '\t' {
+			caret = append(caret, '\t')
+		} else {
+			caret = append(caret, ' ')
+		}
+	}
+	d := &Diagnostics{
+		Err:     err,
+		Pos:     p,
+		Line:    strings.Count(input[:p], "\n") + 1,
+		Column:  utf8.RuneCountInString(input[lineStart:p]) + 1,
+		Snippet: line + "\n" + string(caret) + "^",
+	}
+	if sr.expectedPos == p {
+		d.Expected = sr.expected
+	}
+	return nil, d
+}
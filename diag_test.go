@@ -0,0 +1,53 @@
+package stateparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagSnippet(t *testing.T) {
+	g := And(Lit("let x = "), Label("number", Int()), Lit(";"))
+	_, d := ParseDiag(g, "let y = 1;\n")
+	if d == nil {
+		t.Fatal("ParseDiag succeeded")
+	}
+	if d.Line != 1 || d.Column != 5 {
+		t.Errorf("Line:Column = %d:%d, want 1:5", d.Line, d.Column)
+	}
+	if want := "let y = 1;\n    ^"; d.Snippet != want {
+		t.Errorf("Snippet = %q, want %q", d.Snippet, want)
+	}
+
+	g = And(Lit("// header\nlet x =\t"), Label("number", Int()), Lit(";"))
+	_, d = ParseDiag(g, "// header\nlet x =\tz;")
+	if d == nil {
+		t.Fatal("ParseDiag succeeded")
+	}
+	if d.Line != 2 || d.Column != 9 {
+		t.Errorf("Line:Column = %d:%d, want 2:9", d.Line, d.Column)
+	}
+	if want := "let x =\tz;\n       \t^"; d.Snippet != want {
+		t.Errorf("Snippet = %q, want %q", d.Snippet, want)
+	}
+	if !reflect.DeepEqual(d.Expected, []string{"number"}) {
+		t.Errorf("Expected = %q, want [number]", d.Expected)
+	}
+}
+
+func TestParseDiagMultiRuneLabels(t *testing.T) {
+	g := Or(Label("while", Lit("while")), Label("if", Lit("if")))
+	_, d := ParseDiag(g, "whale")
+	if d == nil {
+		t.Fatal("ParseDiag succeeded")
+	}
+	if d.Pos != 2 || d.Column != 3 {
+		t.Errorf("Pos = %d, Column = %d, want 2 and 3", d.Pos, d.Column)
+	}
+	if !reflect.DeepEqual(d.Expected, []string{"while"}) {
+		t.Errorf("Expected = %q, want [while]", d.Expected)
+	}
+	ee, ok := d.Err.(ExpectedError)
+	if !ok || ee.Pos != d.Pos || !reflect.DeepEqual(ee.Expected, d.Expected) {
+		t.Errorf("Err = %v, want ExpectedError agreeing with the diagnostics", d.Err)
+	}
+}
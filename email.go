@@ -0,0 +1,54 @@
+package stateparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+type emailConfig struct {
+	localChars string
+}
+
+// An EmailOption configures EmailAddress.
+type EmailOption func(*emailConfig)
+
+// EmailLocalChars sets the runes allowed in the dot-separated words of the
+// local part, as a Set pattern. The default is the RFC 5322 atom characters,
+// "A-Za-z0-9!#$%&'*+/=?^_`{|}~-".
+func EmailLocalChars(set string) EmailOption {
+	return func(ec *emailConfig) {
+		ec.localChars = set
+	}
+}
+
+// domainLabel matches one label of a host name: letters, digits and
+// hyphens, not starting or ending with a hyphen and at most 63 bytes long.
+func domainLabel(sr StateReader) (interface{}, error) {
+	state := sr.State()
+	m, err := Mult(1, 0, Set("A-Za-z0-9-"))(sr)
+	if err != nil {
+		return nil, err
+	}
+	label := String(m)
+	if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") || len(label) > 63 {
+		sr.RestoreState(state)
+		return nil, fmt.Errorf("Invalid domain label %q", label)
+	}
+	return label, nil
+}
+
+// EmailAddress matches an email address of the form local@domain and
+// returns it as a string. The rules are pragmatic rather than the full RFC:
+// the local part is one or more words of allowed runes separated by single
+// dots, and the domain is two or more host name labels separated by dots.
+// Quoted local parts and address literals are not accepted.
+func EmailAddress(opts ...EmailOption) Grammar {
+	ec := &emailConfig{localChars: "A-Za-z0-9!#$%&'*+/=?^_`{|}~-"}
+	for _, opt := range opts {
+		opt(ec)
+	}
+	word := Mult(1, 0, Set(ec.localChars))
+	local := And(word, Mult(0, 0, And(Lit("."), word)))
+	domain := And(domainLabel, Mult(1, 0, And(Lit("."), domainLabel)))
+	return Label("email address", Capture(And(local, Lit("@"), domain)))
+}
@@ -0,0 +1,52 @@
+package stateparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailAddress(t *testing.T) {
+	g := AtEnd(EmailAddress())
+	for _, addr := range []string{
+		"user@example.com",
+		"first.last+tag@mail.example.co.uk",
+		"o'brien@example.ie",
+		"x@a-b.io",
+	} {
+		if m, err := Parse(g, addr); err != nil || m != addr {
+			t.Errorf("EmailAddress on %q = %v, %v", addr, m, err)
+		}
+	}
+	for _, addr := range []string{
+		"plainaddress",
+		"@example.com",
+		"user@",
+		"user@localhost",
+		".user@example.com",
+		"us..er@example.com",
+		"user.@example.com",
+		"user@-example.com",
+		"user@example-.com",
+		"user@" + strings.Repeat("a", 64) + ".com",
+		"us er@example.com",
+		`"quoted"@example.com`,
+	} {
+		if m, err := Parse(g, addr); err == nil {
+			t.Errorf("EmailAddress accepted %q as %v", addr, m)
+		}
+	}
+
+	// Inside a larger grammar, trailing punctuation is left alone.
+	sr := NewStringReader("mail user@example.com.")
+	if m, err := And(LitIgnore("mail "), EmailAddress())(sr); err != nil || String(m) != "user@example.com" || sr.Pos() != 21 {
+		t.Errorf("embedded EmailAddress = %#v, %v up to %d", m, err, sr.Pos())
+	}
+
+	strict := AtEnd(EmailAddress(EmailLocalChars("a-z0-9")))
+	if _, err := Parse(strict, "abc.123@example.com"); err != nil {
+		t.Error(err)
+	}
+	if _, err := Parse(strict, "a+b@example.com"); err == nil {
+		t.Error("EmailLocalChars did not restrict the local part")
+	}
+}
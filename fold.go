@@ -0,0 +1,265 @@
+package stateparser
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// CaseFold selects how LitI and SetI compare runes case-insensitively.
+//
+// FoldASCII only folds 'A'-'Z' onto 'a'-'z'. It is fast and predictable,
+// and the right choice for keywords of ASCII languages.
+//
+// FoldUnicode uses Unicode simple case folding, so that for example the
+// Kelvin sign 'K' matches 'k' and 'ſ' matches 's'. Simple folding maps one
+// rune to one rune: it does not fold 'ß' to "ss", and it has no notion of
+// locale, so the Turkish dotted and dotless i are not treated specially.
+//
+// FoldFull uses Unicode full case folding, which adds the folds of one rune
+// to several, so that LitI("straße", FoldFull) matches "STRASSE" and "ﬁ"
+// matches "fi". It costs a table lookup per rune, and like simple folding it
+// ignores locale. A set matches single runes, so SetI treats FoldFull as
+// FoldUnicode.
+type CaseFold int
+
+const (
+	FoldASCII CaseFold = iota
+	FoldUnicode
+	FoldFull
+)
+
+func asciiFold(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	if r >= 'a' && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
+
+// foldEach calls f with r and every rune r folds to under fold, stopping
+// early if f returns true.
+func foldEach(fold CaseFold, r rune, f func(rune) bool) bool {
+	if f(r) {
+		return true
+	}
+	switch fold {
+	case FoldASCII:
+		if fr := asciiFold(r); fr != r {
+			return f(fr)
+		}
+	case FoldUnicode, FoldFull:
+		for fr := unicode.SimpleFold(r); fr != r; fr = unicode.SimpleFold(fr) {
+			if f(fr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LitI matches text case-insensitively according to fold, returning the text
+// as it appeared in the input.
+func LitI(text string, fold CaseFold) Grammar {
+	if text == "" {
+		panic("stateparser: LitI called with empty text")
+	}
+	if fold == FoldFull {
+		return litFull(text)
+	}
+	rs := []rune(text)
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		matched := make([]rune, 0, len(rs))
+		for _, r := range rs {
+			rr, _, err := sr.ReadRune()
+			if err != nil {
+				sr.RestoreState(state)
+				return nil, err
+			}
+			if !foldEach(fold, rr, func(fr rune) bool { return fr == r }) {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Expected %q (any case), got %q", r, rr)
+			}
+			matched = append(matched, rr)
+		}
+		return string(matched), nil
+	}
+}
+
+// SetI is like Set, but matches a rune if any of its case variants under
+// fold is in set.
+func SetI(set string, fold CaseFold) Grammar {
+	ranges := parseSet(set)
+	return satisfy(fmt.Sprintf("\"%s\" (any case)", Escaper.Replace(set)), func(r rune) bool {
+		return foldEach(fold, r, func(fr rune) bool { return inRanges(ranges, fr) })
+	})
+}
+
+// canonicalFold returns the smallest rune r simple-folds to, which is the
+// same for every rune in a case orbit.
+func canonicalFold(r rune) rune {
+	min := r
+	for fr := unicode.SimpleFold(r); fr != r; fr = unicode.SimpleFold(fr) {
+		if fr < min {
+			min = fr
+		}
+	}
+	return min
+}
+
+// appendFullFold appends the full case folding of r to dst, in canonical
+// form so that two foldings can be compared rune by rune.
+func appendFullFold(dst []rune, r rune) []rune {
+	s, ok := fullFolds[r]
+	if !ok {
+		return append(dst, canonicalFold(r))
+	}
+	for _, fr := range s {
+		dst = append(dst, canonicalFold(fr))
+	}
+	return dst
+}
+
+// litFull is LitI under FoldFull. As a fold can span several runes, the
+// input is matched against the folding of text rather than rune by rune,
+// and each input rune must fold to the next part of it in full.
+func litFull(text string) Grammar {
+	var want []rune
+	for _, r := range text {
+		want = appendFullFold(want, r)
+	}
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		var matched, folded []rune
+		for i := 0; i < len(want); {
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				sr.RestoreState(state)
+				return nil, err
+			}
+			folded = appendFullFold(folded[:0], r)
+			ok := i+len(folded) <= len(want)
+			for j := 0; ok && j < len(folded); j++ {
+				ok = folded[j] == want[i+j]
+			}
+			if !ok {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Expected %q (any case), got %q", text, r)
+			}
+			i += len(folded)
+			matched = append(matched, r)
+		}
+		return string(matched), nil
+	}
+}
+
+// fullFolds holds the folds of one rune to several, the entries of status F
+// in the Unicode CaseFolding.txt; all other folds are simple.
+var fullFolds = map[rune]string{
+	0x00DF: "ss",
+	0x0130: "i\u0307",
+	0x0149: "\u02BCn",
+	0x01F0: "j\u030C",
+	0x0390: "\u03B9\u0308\u0301",
+	0x03B0: "\u03C5\u0308\u0301",
+	0x0587: "\u0565\u0582",
+	0x1E96: "h\u0331",
+	0x1E97: "t\u0308",
+	0x1E98: "w\u030A",
+	0x1E99: "y\u030A",
+	0x1E9A: "a\u02BE",
+	0x1E9E: "ss",
+	0x1F50: "\u03C5\u0313",
+	0x1F52: "\u03C5\u0313\u0300",
+	0x1F54: "\u03C5\u0313\u0301",
+	0x1F56: "\u03C5\u0313\u0342",
+	0x1F80: "\u1F00\u03B9",
+	0x1F81: "\u1F01\u03B9",
+	0x1F82: "\u1F02\u03B9",
+	0x1F83: "\u1F03\u03B9",
+	0x1F84: "\u1F04\u03B9",
+	0x1F85: "\u1F05\u03B9",
+	0x1F86: "\u1F06\u03B9",
+	0x1F87: "\u1F07\u03B9",
+	0x1F88: "\u1F00\u03B9",
+	0x1F89: "\u1F01\u03B9",
+	0x1F8A: "\u1F02\u03B9",
+	0x1F8B: "\u1F03\u03B9",
+	0x1F8C: "\u1F04\u03B9",
+	0x1F8D: "\u1F05\u03B9",
+	0x1F8E: "\u1F06\u03B9",
+	0x1F8F: "\u1F07\u03B9",
+	0x1F90: "\u1F20\u03B9",
+	0x1F91: "\u1F21\u03B9",
+	0x1F92: "\u1F22\u03B9",
+	0x1F93: "\u1F23\u03B9",
+	0x1F94: "\u1F24\u03B9",
+	0x1F95: "\u1F25\u03B9",
+	0x1F96: "\u1F26\u03B9",
+	0x1F97: "\u1F27\u03B9",
+	0x1F98: "\u1F20\u03B9",
+	0x1F99: "\u1F21\u03B9",
+	0x1F9A: "\u1F22\u03B9",
+	0x1F9B: "\u1F23\u03B9",
+	0x1F9C: "\u1F24\u03B9",
+	0x1F9D: "\u1F25\u03B9",
+	0x1F9E: "\u1F26\u03B9",
+	0x1F9F: "\u1F27\u03B9",
+	0x1FA0: "\u1F60\u03B9",
+	0x1FA1: "\u1F61\u03B9",
+	0x1FA2: "\u1F62\u03B9",
+	0x1FA3: "\u1F63\u03B9",
+	0x1FA4: "\u1F64\u03B9",
+	0x1FA5: "\u1F65\u03B9",
+	0x1FA6: "\u1F66\u03B9",
+	0x1FA7: "\u1F67\u03B9",
+	0x1FA8: "\u1F60\u03B9",
+	0x1FA9: "\u1F61\u03B9",
+	0x1FAA: "\u1F62\u03B9",
+	0x1FAB: "\u1F63\u03B9",
+	0x1FAC: "\u1F64\u03B9",
+	0x1FAD: "\u1F65\u03B9",
+	0x1FAE: "\u1F66\u03B9",
+	0x1FAF: "\u1F67\u03B9",
+	0x1FB2: "\u1F70\u03B9",
+	0x1FB3: "\u03B1\u03B9",
+	0x1FB4: "\u03AC\u03B9",
+	0x1FB6: "\u03B1\u0342",
+	0x1FB7: "\u03B1\u0342\u03B9",
+	0x1FBC: "\u03B1\u03B9",
+	0x1FC2: "\u1F74\u03B9",
+	0x1FC3: "\u03B7\u03B9",
+	0x1FC4: "\u03AE\u03B9",
+	0x1FC6: "\u03B7\u0342",
+	0x1FC7: "\u03B7\u0342\u03B9",
+	0x1FCC: "\u03B7\u03B9",
+	0x1FD2: "\u03B9\u0308\u0300",
+	0x1FD3: "\u03B9\u0308\u0301",
+	0x1FD6: "\u03B9\u0342",
+	0x1FD7: "\u03B9\u0308\u0342",
+	0x1FE2: "\u03C5\u0308\u0300",
+	0x1FE3: "\u03C5\u0308\u0301",
+	0x1FE4: "\u03C1\u0313",
+	0x1FE6: "\u03C5\u0342",
+	0x1FE7: "\u03C5\u0308\u0342",
+	0x1FF2: "\u1F7C\u03B9",
+	0x1FF3: "\u03C9\u03B9",
+	0x1FF4: "\u03CE\u03B9",
+	0x1FF6: "\u03C9\u0342",
+	0x1FF7: "\u03C9\u0342\u03B9",
+	0x1FFC: "\u03C9\u03B9",
+	0xFB00: "ff",
+	0xFB01: "fi",
+	0xFB02: "fl",
+	0xFB03: "ffi",
+	0xFB04: "ffl",
+	0xFB05: "st",
+	0xFB06: "st",
+	0xFB13: "\u0574\u0576",
+	0xFB14: "\u0574\u0565",
+	0xFB15: "\u0574\u056B",
+	0xFB16: "\u057E\u0576",
+	0xFB17: "\u0574\u056D",
+}
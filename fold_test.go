@@ -0,0 +1,50 @@
+package stateparser
+
+import (
+	"testing"
+)
+
+func TestCaseFold(t *testing.T) {
+	// U+212A is the Kelvin sign, which simple folding maps to 'k'.
+	tests := []struct {
+		g                    func(CaseFold) Grammar
+		input                string
+		ascii, unicode, full bool
+	}{
+		{func(f CaseFold) Grammar { return LitI("select", f) }, "SeLeCt", true, true, true},
+		{func(f CaseFold) Grammar { return LitI("kind", f) }, "\u212aind", false, true, true},
+		{func(f CaseFold) Grammar { return LitI("is", f) }, "iſ", false, true, true},
+		{func(f CaseFold) Grammar { return LitI("straße", f) }, "STRASSE", false, false, true},
+		{func(f CaseFold) Grammar { return LitI("STRASSE", f) }, "straße", false, false, true},
+		{func(f CaseFold) Grammar { return LitI("straße", f) }, "STRAẞE", false, true, true},
+		{func(f CaseFold) Grammar { return LitI("file", f) }, "ﬁle", false, false, true},
+		{func(f CaseFold) Grammar { return LitI("über", f) }, "ÜBER", false, true, true},
+		{func(f CaseFold) Grammar { return SetI("a-z", f) }, "Q", true, true, true},
+		{func(f CaseFold) Grammar { return SetI("k", f) }, "\u212a", false, true, true},
+	}
+	for _, tt := range tests {
+		for _, fold := range []struct {
+			fold CaseFold
+			want bool
+		}{{FoldASCII, tt.ascii}, {FoldUnicode, tt.unicode}, {FoldFull, tt.full}} {
+			m, err := Parse(tt.g(fold.fold), tt.input)
+			if (err == nil) != fold.want {
+				t.Errorf("fold %d on %q = %v, %v, want match %v", fold.fold, tt.input, m, err, fold.want)
+			} else if err == nil && m != tt.input {
+				t.Errorf("fold %d on %q = %q, want the input text", fold.fold, tt.input, m)
+			}
+		}
+	}
+}
+
+func TestFoldFullWholeRunes(t *testing.T) {
+	// A rune folding to several must match all of them: "ß" is not an "s".
+	sr := NewStringReader("ßx")
+	if m, err := LitI("s", FoldFull)(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("LitI(s) on ß = %v, %v at %d, want failure at 0", m, err, sr.Pos())
+	}
+	sr = NewStringReader("Maße!")
+	if m, err := LitI("MASSE", FoldFull)(sr); err != nil || m != "Maße" || sr.Pos() != len("Maße") {
+		t.Errorf("LitI(MASSE) = %v, %v at %d", m, err, sr.Pos())
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/andyleap/stateparser
 
-go 1.14
+go 1.18
@@ -0,0 +1,51 @@
+package stateparser
+
+import "hash"
+
+// ConsumedHasher is implemented by readers that can hash the input consumed
+// so far. ConsumedHash returns the digest of all input before the current
+// position, reflecting any backtracking.
+type ConsumedHasher interface {
+	ConsumedHash() []byte
+}
+
+// HashConsumed makes the StringReader feed consumed input into h, so that
+// ConsumedHash can report a digest of everything before the current
+// position. Bytes are hashed lazily when a digest is asked for; if the
+// reader has backtracked behind what was hashed, h is reset and the prefix
+// hashed again.
+func HashConsumed(h hash.Hash) Option {
+	return func(sr *StringReader) {
+		sr.hash = h
+	}
+}
+
+func (sr *StringReader) ConsumedHash() []byte {
+	if sr.hash == nil {
+		return nil
+	}
+	if sr.pos < sr.hashed {
+		sr.hash.Reset()
+		sr.hashed = 0
+	}
+	sr.hash.Write([]byte(sr.src[sr.hashed:sr.pos]))
+	sr.hashed = sr.pos
+	return sr.hash.Sum(nil)
+}
+
+// ConsumedHash returns the digest of the input sr has consumed so far,
+// reporting false if sr doesn't implement ConsumedHasher or was not
+// configured with a hash.
+func ConsumedHash(sr StateReader) ([]byte, bool) {
+	for {
+		if ch, ok := sr.(ConsumedHasher); ok {
+			sum := ch.ConsumedHash()
+			return sum, sum != nil
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
@@ -0,0 +1,61 @@
+package stateparser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func sha(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+func TestHashConsumed(t *testing.T) {
+	var got []byte
+	record := func(sr StateReader) (interface{}, error) {
+		got, _ = ConsumedHash(sr)
+		return nil, nil
+	}
+	// The first alternative reads past "hdr:" before failing, so the hash
+	// must forget the backtracked bytes.
+	g := And(Or(Lit("hdr:xyz"), Lit("hdr:")), Lit("body"), record)
+	sr := NewStringReader("hdr:body;rest", HashConsumed(sha256.New()))
+	if _, err := g(sr); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, sha("hdr:body")) {
+		t.Errorf("ConsumedHash = %x, want sha256 of %q", got, "hdr:body")
+	}
+
+	// Asking again after backtracking behind the hashed prefix rehashes it.
+	state := NewStringReader("").State()
+	sr.RestoreState(state)
+	if sum := sr.ConsumedHash(); !bytes.Equal(sum, sha("")) {
+		t.Errorf("ConsumedHash at start = %x, want sha256 of empty input", sum)
+	}
+	Lit("hdr")(sr)
+	if sum := sr.ConsumedHash(); !bytes.Equal(sum, sha("hdr")) {
+		t.Errorf("ConsumedHash = %x, want sha256 of %q", sum, "hdr")
+	}
+}
+
+func TestHashConsumedFork(t *testing.T) {
+	sr := NewStringReader("abcdef", HashConsumed(sha256.New()))
+	Lit("ab")(sr)
+	f := sr.Fork()
+	Lit("cd")(f)
+	if _, ok := ConsumedHash(f); ok {
+		t.Error("fork reports a ConsumedHash")
+	}
+	Lit("c")(sr)
+	if sum, _ := ConsumedHash(sr); !bytes.Equal(sum, sha("abc")) {
+		t.Errorf("ConsumedHash after fork = %x, want sha256 of %q", sum, "abc")
+	}
+}
+
+func TestHashConsumedUnset(t *testing.T) {
+	if _, ok := ConsumedHash(NewStringReader("x")); ok {
+		t.Error("ConsumedHash reported without HashConsumed")
+	}
+}
@@ -0,0 +1,176 @@
+package json
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	sp "github.com/andyleap/stateparser"
+)
+
+// value boxes a parsed JSON value so that nulls survive And, which drops nil
+// matches, and so that arrays aren't confused with the grammar's own
+// []interface{} results.
+type value struct {
+	v interface{}
+}
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+// JSON returns a grammar matching a single JSON value, with optional
+// surrounding whitespace. Objects become map[string]interface{}, arrays
+// []interface{}, numbers float64, and strings, booleans and null their
+// natural Go counterparts.
+func JSON() sp.Grammar {
+	var val sp.Grammar
+
+	ws := sp.Ignore(sp.Mult(0, 0, sp.Set(" \t\n\r")))
+	digits := sp.Mult(1, 0, sp.Set("0-9"))
+	hex := sp.Set("0-9a-fA-F")
+
+	number := sp.Node(sp.And(
+		sp.Optional(sp.Lit("-")),
+		sp.Or(sp.Lit("0"), sp.And(sp.Set("1-9"), sp.Mult(0, 0, sp.Set("0-9")))),
+		sp.Optional(sp.And(sp.Lit("."), digits)),
+		sp.Optional(sp.And(sp.Set("eE"), sp.Optional(sp.Set("+-")), digits)),
+	), func(m interface{}) (interface{}, error) {
+		return strconv.ParseFloat(sp.String(m), 64)
+	})
+
+	escape := sp.Node(sp.And(sp.Ignore(sp.Lit("\\")), sp.Or(
+		sp.Node(sp.Set("\"\\/bfnrt"), func(m interface{}) (interface{}, error) {
+			switch m.(string) {
+			case "b":
+				return "\b", nil
+			case "f":
+				return "\f", nil
+			case "n":
+				return "\n", nil
+			case "r":
+				return "\r", nil
+			case "t":
+				return "\t", nil
+			}
+			return m, nil
+		}),
+		sp.Node(sp.And(sp.Ignore(sp.Lit("u")), sp.Mult(4, 4, hex)), func(m interface{}) (interface{}, error) {
+			u, err := strconv.ParseUint(sp.String(m), 16, 16)
+			if err != nil {
+				return nil, err
+			}
+			return uint16(u), nil
+		}),
+	)), func(m interface{}) (interface{}, error) {
+		return m.([]interface{})[0], nil
+	})
+
+	str := sp.Node(sp.And(
+		sp.Ignore(sp.Lit("\"")),
+		sp.Mult(0, 0, sp.Or(
+			sp.NotSet("\"\\\x00-\x1f"),
+			escape,
+		)),
+		sp.Ignore(sp.Lit("\"")),
+	), func(m interface{}) (interface{}, error) {
+		return decodeString(m.([]interface{})[0].([]interface{})), nil
+	})
+
+	array := sp.Node(sp.And(
+		sp.Ignore(sp.Lit("[")), ws,
+		sp.Optional(sp.And(
+			sp.Resolve(&val),
+			sp.Mult(0, 0, sp.And(ws, sp.Ignore(sp.Lit(",")), ws, sp.Resolve(&val))),
+		)),
+		ws, sp.Ignore(sp.Lit("]")),
+	), func(m interface{}) (interface{}, error) {
+		arr := []interface{}{}
+		for _, e := range flatten(m) {
+			arr = append(arr, unwrap(e))
+		}
+		return arr, nil
+	})
+
+	memberG := sp.Node(sp.And(
+		str, ws, sp.Ignore(sp.Lit(":")), ws, sp.Resolve(&val),
+	), func(m interface{}) (interface{}, error) {
+		ms := m.([]interface{})
+		return member{key: ms[0].(string), value: unwrap(ms[1])}, nil
+	})
+
+	object := sp.Node(sp.And(
+		sp.Ignore(sp.Lit("{")), ws,
+		sp.Optional(sp.And(
+			memberG,
+			sp.Mult(0, 0, sp.And(ws, sp.Ignore(sp.Lit(",")), ws, memberG)),
+		)),
+		ws, sp.Ignore(sp.Lit("}")),
+	), func(m interface{}) (interface{}, error) {
+		obj := map[string]interface{}{}
+		for _, e := range flatten(m) {
+			mem := e.(member)
+			obj[mem.key] = mem.value
+		}
+		return obj, nil
+	})
+
+	val = sp.Node(sp.Or(
+		object,
+		array,
+		str,
+		number,
+		sp.Node(sp.Lit("true"), func(interface{}) (interface{}, error) { return true, nil }),
+		sp.Node(sp.Lit("false"), func(interface{}) (interface{}, error) { return false, nil }),
+		sp.Node(sp.Lit("null"), func(interface{}) (interface{}, error) { return nil, nil }),
+	), func(m interface{}) (interface{}, error) {
+		return value{m}, nil
+	})
+
+	return sp.Node(sp.And(ws, val, ws), func(m interface{}) (interface{}, error) {
+		return unwrap(m.([]interface{})[0]), nil
+	})
+}
+
+func unwrap(m interface{}) interface{} {
+	return m.(value).v
+}
+
+// flatten collects the values and members from the nested slices produced
+// by the element lists of arrays and objects.
+func flatten(m interface{}) []interface{} {
+	ms, ok := m.([]interface{})
+	if !ok {
+		return []interface{}{m}
+	}
+	out := []interface{}{}
+	for _, mi := range ms {
+		out = append(out, flatten(mi)...)
+	}
+	return out
+}
+
+func decodeString(parts []interface{}) string {
+	var b strings.Builder
+	for i := 0; i < len(parts); i++ {
+		switch p := parts[i].(type) {
+		case string:
+			b.WriteString(p)
+		case uint16:
+			r := rune(p)
+			if utf16.IsSurrogate(r) && i+1 < len(parts) {
+				if lo, ok := parts[i+1].(uint16); ok {
+					if dr := utf16.DecodeRune(r, rune(lo)); dr != unicode.ReplacementChar {
+						b.WriteRune(dr)
+						i++
+						continue
+					}
+				}
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package json
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	sp "github.com/andyleap/stateparser"
+)
+
+func TestAccept(t *testing.T) {
+	inputs := []string{
+		`0`, `-0`, `123`, `-12.5`, `1e10`, `1E+2`, `2.5e-3`, `-0.0e0`,
+		`""`, `"plain"`, `"\"\\\/\b\f\n\r\t"`, `"Aé世"`,
+		`"\ud83d\ude00"`, `"x\uD834\uDD1Ey"`, `"\ud83d"`, `"\ude00x"`, `"héllo 世界"`,
+		`true`, `false`, `null`,
+		`[]`, `[1, "a", null, true]`, `[[[]], [[1]]]`, `[null]`,
+		`{}`, `{"a": 1}`, `{"a": {"b": [1, {"c": null}]}, "d": "e"}`,
+		`{"a": 1, "a": 2}`,
+		" \t\n\r[ 1 ,\n2 ] \n",
+	}
+	g := sp.AtEnd(JSON())
+	for _, input := range inputs {
+		var want interface{}
+		if err := json.Unmarshal([]byte(input), &want); err != nil {
+			t.Fatalf("%q: encoding/json: %v", input, err)
+		}
+		got, err := sp.Parse(g, input)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %#v, want %#v", input, got, want)
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	inputs := []string{
+		``, ` `,
+		`01`, `-`, `+1`, `1.`, `.5`, `1e`, `1e+`, `0x10`, `NaN`, `Infinity`,
+		`"unterminated`, `"\x"`, `"\u12"`, `"\u12g4"`, "\"tab\there\"", "\"\x01\"",
+		`'single'`, `tru`, `nul`, `True`,
+		`[`, `[1,]`, `[,1]`, `[1 2]`, `]`,
+		`{`, `{"a"}`, `{"a":}`, `{a: 1}`, `{"a": 1,}`, `{1: 2}`,
+		`1 2`, `[] []`, `{}x`, `null,`, `"a" "b"`,
+	}
+	g := sp.AtEnd(JSON())
+	for _, input := range inputs {
+		if err := json.Unmarshal([]byte(input), new(interface{})); err == nil {
+			t.Fatalf("%q: encoding/json accepted it", input)
+		}
+		if m, err := sp.Parse(g, input); err == nil {
+			t.Errorf("%q: accepted as %#v", input, m)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package stateparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExpectedError reports that one of the named constructs was expected. Pos
+// is the byte offset at which the attempt to match them failed, the
+// furthest any of them read, or -1 if the reader doesn't track positions.
+type ExpectedError struct {
+	Expected []string
+	Pos      int
+}
+
+func (ee ExpectedError) Error() string {
+	var what string
+	switch n := len(ee.Expected); n {
+	case 0:
+		// Only a hand-built ExpectedError can name nothing.
+		if ee.Pos < 0 {
+			return "Unexpected input"
+		}
+		return fmt.Sprintf("Unexpected input at offset %d", ee.Pos)
+	case 1:
+		what = ee.Expected[0]
+	default:
+		what = strings.Join(ee.Expected[:n-1], ", ") + " or " + ee.Expected[n-1]
+	}
+	if ee.Pos < 0 {
+		return fmt.Sprintf("Expected %s", what)
+	}
+	return fmt.Sprintf("Expected %s at offset %d", what, ee.Pos)
+}
+
+// Label gives g a human readable name. When g fails non-fatally the error is
+// replaced by an ExpectedError naming it, positioned at the furthest offset g
+// read, and an Or whose alternatives are all labelled reports the names of
+// those that got furthest.
+func Label(name string, g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		p := pos(sr)
+		ft, tracked := tracker(sr)
+		var before int
+		if tracked {
+			before = ft.swapFurthest(p)
+		}
+		m, err := g(sr)
+		if tracked {
+			reached := ft.swapFurthest(before)
+			if reached > before {
+				ft.swapFurthest(reached)
+			}
+			if reached > p {
+				p = reached
+			}
+		}
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			recordExpected(sr, name, p)
+			return nil, ExpectedError{Expected: []string{name}, Pos: p}
+		}
+		return m, nil
+	}
+}
+
+// mergeExpected combines the errors of failed alternatives into a single
+// ExpectedError if they are all ExpectedErrors, keeping the names of those
+// that failed furthest in.
+func mergeExpected(errs []error) (ExpectedError, bool) {
+	if len(errs) == 0 {
+		return ExpectedError{}, false
+	}
+	merged := ExpectedError{Pos: -1}
+	seen := map[string]bool{}
+	for _, err := range errs {
+		ee, ok := err.(ExpectedError)
+		if !ok {
+			return ExpectedError{}, false
+		}
+		if ee.Pos < merged.Pos {
+			continue
+		}
+		if ee.Pos > merged.Pos {
+			merged.Expected, merged.Pos = nil, ee.Pos
+			seen = map[string]bool{}
+		}
+		for _, name := range ee.Expected {
+			if !seen[name] {
+				seen[name] = true
+				merged.Expected = append(merged.Expected, name)
+			}
+		}
+	}
+	return merged, true
+}
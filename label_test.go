@@ -0,0 +1,43 @@
+package stateparser
+
+import (
+	"testing"
+)
+
+func TestLabelOr(t *testing.T) {
+	number := Label("number", Mult(1, 0, Set("0-9")))
+	str := Label("string", And(Lit(`"`), Many(ExceptRune('"')), Lit(`"`)))
+	_, err := Parse(Or(number, str), "true")
+	pe, ok := err.(ParseError)
+	if !ok {
+		t.Fatalf("Parse = %v, want ParseError", err)
+	}
+	if got, want := pe.Err.Error(), "Expected number or string at offset 0"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+
+	// Only the alternatives that got furthest are named.
+	keyword := Label("keyword", Lit("let"))
+	_, err = Parse(Or(number, str, keyword), `"abc`)
+	pe, _ = err.(ParseError)
+	if ee, ok := pe.Err.(ExpectedError); !ok || len(ee.Expected) != 1 || ee.Expected[0] != "string" || ee.Pos != 4 {
+		t.Errorf("error = %#v, want string expected at 4", err)
+	}
+}
+
+func TestExpectedErrorMessage(t *testing.T) {
+	tests := []struct {
+		ee   ExpectedError
+		want string
+	}{
+		{ExpectedError{Expected: []string{"number"}, Pos: 3}, "Expected number at offset 3"},
+		{ExpectedError{Expected: []string{"a", "b", "c"}, Pos: -1}, "Expected a, b or c"},
+		{ExpectedError{Pos: 4}, "Unexpected input at offset 4"},
+		{ExpectedError{Pos: -1}, "Unexpected input"},
+	}
+	for _, tt := range tests {
+		if got := tt.ee.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
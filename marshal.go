@@ -0,0 +1,86 @@
+package stateparser
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type taggedJSON struct {
+	Tag   string      `json:"tag"`
+	Match interface{} `json:"match"`
+}
+
+func toJSON(m interface{}) (interface{}, error) {
+	switch m := m.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return m, nil
+	case []interface{}:
+		out := make([]interface{}, len(m))
+		for i, mi := range m {
+			v, err := toJSON(mi)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case TaggedMatch:
+		v, err := toJSON(m.Match)
+		if err != nil {
+			return nil, err
+		}
+		return taggedJSON{Tag: m.Tag, Match: v}, nil
+	}
+	return nil, fmt.Errorf("Cannot marshal match of type %T", m)
+}
+
+// Marshal serializes a match tree of strings, []interface{} and
+// TaggedMatch as JSON. Strings and slices map to JSON strings and arrays, and
+// a TaggedMatch to an object {"tag": ..., "match": ...}. Any other value in
+// the tree, such as the result of a Node transform, is an error.
+func Marshal(m interface{}) ([]byte, error) {
+	v, err := toJSON(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func fromJSON(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, string:
+		return v, nil
+	case []interface{}:
+		for i, vi := range v {
+			m, err := fromJSON(vi)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = m
+		}
+		return v, nil
+	case map[string]interface{}:
+		tag, ok := v["tag"].(string)
+		_, hasMatch := v["match"]
+		if !ok || !hasMatch || len(v) != 2 {
+			return nil, fmt.Errorf("Expected a tagged match object, got %v", v)
+		}
+		m, err := fromJSON(v["match"])
+		if err != nil {
+			return nil, err
+		}
+		return TaggedMatch{Match: m, Tag: tag}, nil
+	}
+	return nil, fmt.Errorf("Cannot unmarshal %T into a match", v)
+}
+
+// Unmarshal rebuilds a match tree from the JSON produced by Marshal.
+func Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return fromJSON(v)
+}
@@ -0,0 +1,65 @@
+package stateparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalRoundTrip(t *testing.T) {
+	word := Capture(Many1(Set("a-z")))
+	g := Tag("pair", And(Tag("key", word), Lit("="), Tag("value", And(Tag("inner", word), Lit(";")))))
+	m, err := Parse(g, "abc=def;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, m) {
+		t.Fatalf("Unmarshal(Marshal(m)) = %#v, want %#v", back, m)
+	}
+	pair := GetTag(back, "pair")
+	if got := String(GetTag(pair, "key")); got != "abc" {
+		t.Errorf("key = %q, want %q", got, "abc")
+	}
+	if got := String(GetTag(GetTag(pair, "value"), "inner")); got != "def" {
+		t.Errorf("inner = %q, want %q", got, "def")
+	}
+}
+
+func TestUnmarshalRejectsMalformedTag(t *testing.T) {
+	for _, data := range []string{
+		`{"tag":"x","foo":1}`,
+		`{"tag":"x"}`,
+		`{"tag":1,"match":"y"}`,
+		`{"tag":"x","match":"y","extra":"z"}`,
+		`1`,
+	} {
+		if m, err := Unmarshal([]byte(data)); err == nil {
+			t.Errorf("Unmarshal(%s) = %#v, want error", data, m)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	m := []interface{}{TaggedMatch{Tag: "a", Match: []interface{}{"x", nil}}, "y", []interface{}{}}
+	data, err := Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"tag":"a","match":["x",null]},"y",[]]`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+	back, err := Unmarshal(data)
+	if err != nil || !reflect.DeepEqual(back, m) {
+		t.Errorf("Unmarshal = %#v, %v, want %#v", back, err, m)
+	}
+	if _, err := Marshal([]interface{}{"x", 3}); err == nil {
+		t.Error("Marshal accepted an int in the tree")
+	}
+}
@@ -0,0 +1,68 @@
+package stateparser
+
+import (
+	"fmt"
+	"net"
+)
+
+var ipRune = Set("0-9A-Fa-f:.")
+
+// IPAddress matches an IPv4 or IPv6 literal and returns it as a net.IP.
+// Candidate runes are collected and the longest prefix net.ParseIP accepts
+// is consumed, so a trailing port or full stop is left for what follows; a
+// prefix that would split a run of digits is never taken. If no prefix is a
+// valid address nothing is consumed.
+func IPAddress() Grammar {
+	return Label("IP address", func(sr StateReader) (interface{}, error) {
+		start := sr.State()
+		done := speculate(sr)
+		defer done()
+		states := []interface{}{}
+		text := ""
+		for {
+			m, err := ipRune(sr)
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				break
+			}
+			text += m.(string)
+			states = append(states, sr.State())
+		}
+		for n := len(text); n > 0; n-- {
+			if n < len(text) {
+				if _, isHex := unhex(rune(text[n])); isHex {
+					continue
+				}
+			}
+			if ip := net.ParseIP(text[:n]); ip != nil {
+				sr.RestoreState(states[n-1])
+				return ip, nil
+			}
+		}
+		sr.RestoreState(start)
+		return nil, fmt.Errorf("Expected an IP address")
+	})
+}
+
+var cidrToken = Capture(And(IPAddress(), Lit("/"), Many1(Set("0-9"))))
+
+// CIDR matches a CIDR block such as "10.0.0.0/8" or "2001:db8::/32" and
+// returns it as a *net.IPNet, as from net.ParseCIDR. An invalid prefix
+// length fails without consuming anything.
+func CIDR() Grammar {
+	return Label("CIDR block", func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := cidrToken(sr)
+		if err != nil {
+			return nil, err
+		}
+		_, ipnet, err := net.ParseCIDR(m.(string))
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return ipnet, nil
+	})
+}
@@ -0,0 +1,63 @@
+package stateparser
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPAddress(t *testing.T) {
+	tests := []struct {
+		input, want string
+		pos         int
+	}{
+		{"192.168.0.1", "192.168.0.1", 11},
+		{"10.0.0.1:8080", "10.0.0.1", 8},
+		{"10.0.0.1.", "10.0.0.1", 8},
+		{"2001:db8::1 rest", "2001:db8::1", 11},
+		{"::1", "::1", 3},
+		{"::ffff:1.2.3.4", "1.2.3.4", 14},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := IPAddress()(sr)
+		if err != nil {
+			t.Errorf("IPAddress on %q: %v", tt.input, err)
+			continue
+		}
+		if ip := m.(net.IP); !ip.Equal(net.ParseIP(tt.want)) || sr.Pos() != tt.pos {
+			t.Errorf("IPAddress on %q = %v up to %d, want %s up to %d", tt.input, ip, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, input := range []string{"256.1.1.1", "1.2.3", "12345::g", "host", "1.2.3.45678"} {
+		sr := NewStringReader(input)
+		if m, err := IPAddress()(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("IPAddress on %q = %v, %v at %d, want failure at 0", input, m, err, sr.Pos())
+		}
+	}
+	if m, err := Parse(Or(IPAddress(), Capture(Many1(NotSet("")))), "999.1.1.1"); err != nil || m != "999.1.1.1" {
+		t.Errorf("Or after IPAddress = %v, %v", m, err)
+	}
+}
+
+func TestCIDR(t *testing.T) {
+	for _, tt := range []struct{ input, want string }{
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"192.168.1.7/24 allow", "192.168.1.0/24"},
+		{"2001:db8::/32", "2001:db8::/32"},
+	} {
+		m, err := Parse(CIDR(), tt.input)
+		if err != nil {
+			t.Errorf("CIDR on %q: %v", tt.input, err)
+			continue
+		}
+		if got := m.(*net.IPNet).String(); got != tt.want {
+			t.Errorf("CIDR on %q = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+	for _, input := range []string{"10.0.0.0/33", "2001:db8::/129", "10.0.0.0", "10.0.0.0/"} {
+		sr := NewStringReader(input)
+		if m, err := CIDR()(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("CIDR on %q = %v, %v at %d, want failure at 0", input, m, err, sr.Pos())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package stateparser
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// LengthPrefixed runs lengthG, converts its match to an int (either an int
+// match directly, or its text in decimal) and parses the rest with the
+// grammar built by makeBody for that length.
+func LengthPrefixed(lengthG Grammar, makeBody func(n int) Grammar) Grammar {
+	return Bind(lengthG, func(m interface{}) Grammar {
+		n, ok := m.(int)
+		if !ok {
+			var err error
+			n, err = strconv.Atoi(String(m))
+			if err != nil {
+				return fail(fmt.Errorf("Invalid length %q: %s", String(m), err))
+			}
+		}
+		if n < 0 {
+			return fail(fmt.Errorf("Invalid length %d", n))
+		}
+		return makeBody(n)
+	})
+}
+
+// bytesN matches exactly n bytes of input, as reported by ReadRune, and
+// returns them as a string.
+func bytesN(n int) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		rs := []rune{}
+		for read := 0; read < n; {
+			r, size, err := sr.ReadRune()
+			if err != nil {
+				sr.RestoreState(state)
+				return nil, err
+			}
+			rs = append(rs, r)
+			read += size
+			if read > n {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Expected %d bytes, got a rune spanning past them", n)
+			}
+		}
+		return string(rs), nil
+	}
+}
+
+// Netstring matches a DJB netstring, "<len>:<data>,", and returns data. It
+// is an error for data to not be exactly len bytes long.
+func Netstring() Grammar {
+	return LengthPrefixed(
+		And(Mult(1, 0, Set("0-9")), LitIgnore(":")),
+		func(n int) Grammar {
+			body := bytesN(n)
+			comma := Lit(",")
+			return func(sr StateReader) (interface{}, error) {
+				state := sr.State()
+				m, err := body(sr)
+				if err == nil {
+					_, err = comma(sr)
+				}
+				if err != nil {
+					if _, isFE := err.(fatalError); isFE {
+						return nil, err
+					}
+					sr.RestoreState(state)
+					return nil, fmt.Errorf("Netstring body does not match declared length %d: %s", n, err)
+				}
+				return m, nil
+			}
+		},
+	)
+}
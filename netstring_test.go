@@ -0,0 +1,33 @@
+package stateparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetstring(t *testing.T) {
+	sr := NewStringReader("5:hello,12:hello world!,")
+	for _, want := range []string{"hello", "hello world!"} {
+		m, err := Netstring()(sr)
+		if err != nil || m != want {
+			t.Errorf("Netstring = %v, %v, want %q", m, err, want)
+		}
+	}
+	if m, err := Parse(Netstring(), "0:,"); err != nil || m != "" {
+		t.Errorf("empty Netstring = %v, %v", m, err)
+	}
+	// The length counts bytes, not runes.
+	if m, err := Parse(Netstring(), "3:é!,"); err != nil || m != "é!" {
+		t.Errorf("multibyte Netstring = %v, %v", m, err)
+	}
+
+	for _, input := range []string{"5:hell,", "3:hello,", "5:hello", "2:é!,"} {
+		_, err := Parse(Netstring(), input)
+		if err == nil || !strings.Contains(err.Error(), "does not match declared length") {
+			t.Errorf("Netstring on %q = %v, want length mismatch", input, err)
+		}
+	}
+	if _, err := Parse(Netstring(), ":hello,"); err == nil {
+		t.Error("Netstring matched without a length")
+	}
+}
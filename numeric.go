@@ -0,0 +1,192 @@
+package stateparser
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var integer = Capture(And(Optional(Set("+-")), Many1(Set("0-9"))))
+
+// Int matches an optionally signed decimal integer and returns it as an int.
+// An integer that doesn't fit in an int is an error.
+func Int() Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := integer(sr)
+		if err != nil {
+			return nil, err
+		}
+		i, err := strconv.Atoi(m.(string))
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return i, nil
+	}
+}
+
+// BigInt matches an optionally signed decimal integer of any size and
+// returns it as a *big.Int.
+func BigInt() Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := integer(sr)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := new(big.Int).SetString(m.(string), 10)
+		if !ok {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Invalid integer %q", m)
+		}
+		return i, nil
+	}
+}
+
+// Signed matches an optional '+' or '-' followed by numG, and returns what
+// apply makes of numG's match given whether the sign was '-'. This lets any
+// unsigned number grammar, including ones producing a *big.Int, share the
+// same sign handling.
+func Signed(numG Grammar, apply func(neg bool, m interface{}) interface{}) Grammar {
+	sign := Optional(Set("+-"))
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		s, err := sign(sr)
+		if err != nil {
+			return nil, err
+		}
+		m, err := numG(sr)
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return apply(String(s) == "-", m), nil
+	}
+}
+
+var float = Capture(And(
+	Optional(Set("+-")),
+	Or(
+		And(Many1(Set("0-9")), Optional(And(Lit("."), Many(Set("0-9"))))),
+		And(Lit("."), Many1(Set("0-9"))),
+	),
+	Optional(And(Set("eE"), Optional(Set("+-")), Many1(Set("0-9")))),
+))
+
+// Float matches a decimal floating point number with an optional sign,
+// fraction and exponent, such as "-3", "2.5" or "1e-9", and returns it as a
+// float64.
+func Float() Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := float(sr)
+		if err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(m.(string), 64)
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+// FloatList matches zero or more floats separated by sep and returns them
+// as a []float64.
+func FloatList(sep Grammar) Grammar {
+	return Node(SepBy(Float(), sep), func(m interface{}) (interface{}, error) {
+		ms := m.([]interface{})
+		fs := make([]float64, len(ms))
+		for i, mi := range ms {
+			fs[i] = mi.(float64)
+		}
+		return fs, nil
+	})
+}
+
+// IntInRange matches an integer, like Int, only if it lies within [lo, hi],
+// and otherwise fails without consuming anything.
+func IntInRange(lo, hi int) Grammar {
+	i := Int()
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := i(sr)
+		if err != nil {
+			return nil, err
+		}
+		if n := m.(int); n < lo || n > hi {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Expected an integer in [%d, %d], got %d", lo, hi, n)
+		}
+		return m, nil
+	}
+}
+
+var decimalToken = Capture(And(
+	Optional(Set("+-")),
+	Many1(Set("0-9")),
+	Optional(And(Lit("."), Many1(Set("0-9")))),
+))
+
+// Decimal matches a fixed-point decimal number such as "-12.34" and returns
+// it as an int64 scaled by 10^scale, so "12.34" with scale 2 is 1234. More
+// than scale fractional digits is an error, as is a value that doesn't fit
+// in an int64. See DecimalRounded to round instead.
+func Decimal(scale int) Grammar {
+	return decimal(scale, false)
+}
+
+// DecimalRounded is like Decimal, but rounds excess fractional digits half
+// away from zero instead of failing.
+func DecimalRounded(scale int) Grammar {
+	return decimal(scale, true)
+}
+
+func decimal(scale int, round bool) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := decimalToken(sr)
+		if err != nil {
+			return nil, err
+		}
+		s := m.(string)
+		sign := ""
+		if s[0] == '+' || s[0] == '-' {
+			sign, s = s[:1], s[1:]
+		}
+		whole, frac := s, ""
+		if dot := strings.IndexByte(s, '.'); dot >= 0 {
+			whole, frac = s[:dot], s[dot+1:]
+		}
+		roundAway := false
+		if len(frac) > scale {
+			if !round {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Expected at most %d fractional digits in %q", scale, m)
+			}
+			roundAway = frac[scale] >= '5'
+			frac = frac[:scale]
+		}
+		frac += strings.Repeat("0", scale-len(frac))
+		n, err := strconv.ParseInt(sign+whole+frac, 10, 64)
+		if err == nil && roundAway {
+			switch {
+			case sign == "-" && n == math.MinInt64, sign != "-" && n == math.MaxInt64:
+				err = strconv.ErrRange
+			case sign == "-":
+				n--
+			default:
+				n++
+			}
+		}
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Decimal %q out of range", m)
+		}
+		return n, nil
+	}
+}
@@ -0,0 +1,134 @@
+package stateparser
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBigInt(t *testing.T) {
+	digits := "1" + strings.Repeat("234567890", 11)
+	for _, input := range []string{digits, "-" + digits, "+" + digits, "0"} {
+		want, _ := new(big.Int).SetString(input, 10)
+		m, err := Parse(BigInt(), input+" ")
+		if err != nil {
+			t.Errorf("BigInt on %q: %v", input, err)
+			continue
+		}
+		if got := m.(*big.Int); got.Cmp(want) != 0 {
+			t.Errorf("BigInt on %q = %v", input, got)
+		}
+	}
+	for _, input := range []string{"-", "x1", ""} {
+		if _, err := Parse(BigInt(), input); err == nil {
+			t.Errorf("BigInt matched %q", input)
+		}
+	}
+	if _, err := Parse(Int(), digits); err == nil {
+		t.Error("Int accepted a 100-digit number")
+	}
+}
+
+func TestSigned(t *testing.T) {
+	unsigned := Node(Many1(Set("0-9")), func(m interface{}) (interface{}, error) {
+		n, _ := new(big.Int).SetString(String(m), 10)
+		return n, nil
+	})
+	g := Signed(unsigned, func(neg bool, m interface{}) interface{} {
+		if neg {
+			return new(big.Int).Neg(m.(*big.Int))
+		}
+		return m
+	})
+	for _, tt := range []struct {
+		input string
+		want  int64
+	}{{"-42", -42}, {"+42", 42}, {"42", 42}} {
+		m, err := Parse(g, tt.input)
+		if err != nil || m.(*big.Int).Int64() != tt.want {
+			t.Errorf("Signed on %q = %v, %v, want %d", tt.input, m, err, tt.want)
+		}
+	}
+	sr := NewStringReader("-x")
+	if _, err := g(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("Signed = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestFloatList(t *testing.T) {
+	g := FloatList(And(Lit(","), Many(Lit(" "))))
+	m, err := Parse(g, "1.0, 2.5, -3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.([]float64), []float64{1.0, 2.5, -3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FloatList = %v, want %v", got, want)
+	}
+	if m, err := Parse(g, ""); err != nil || len(m.([]float64)) != 0 {
+		t.Errorf("FloatList on empty input = %#v, %v", m, err)
+	}
+	for _, tt := range []struct {
+		input string
+		want  float64
+	}{{"1e-9", 1e-9}, {".5", 0.5}, {"+7.", 7}, {"-0.25E2", -25}} {
+		if m, err := Parse(Float(), tt.input); err != nil || m != tt.want {
+			t.Errorf("Float on %q = %v, %v, want %v", tt.input, m, err, tt.want)
+		}
+	}
+}
+
+func TestIntInRange(t *testing.T) {
+	status := IntInRange(100, 599)
+	for _, tt := range []struct {
+		input string
+		ok    bool
+	}{{"200", true}, {"100", true}, {"599", true}, {"42", false}, {"600", false}, {"-200", false}} {
+		sr := NewStringReader(tt.input)
+		m, err := status(sr)
+		if (err == nil) != tt.ok || !tt.ok && sr.Pos() != 0 {
+			t.Errorf("IntInRange on %q = %v, %v at %d, want match %v", tt.input, m, err, sr.Pos(), tt.ok)
+		}
+	}
+	g := Or(status, Capture(Many1(Set("0-9"))))
+	if m, err := Parse(g, "42"); err != nil || m != "42" {
+		t.Errorf("Or after IntInRange = %v, %v", m, err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		g     Grammar
+		input string
+		want  int64
+	}{
+		{Decimal(2), "12.34", 1234},
+		{Decimal(2), "12.3", 1230},
+		{Decimal(2), "12", 1200},
+		{Decimal(2), "-0.05", -5},
+		{Decimal(0), "7", 7},
+		{DecimalRounded(2), "1.005", 101},
+		{DecimalRounded(2), "1.004", 100},
+		{DecimalRounded(2), "-1.005", -101},
+		{DecimalRounded(1), "9.99", 100},
+	}
+	for _, tt := range tests {
+		if m, err := Parse(tt.g, tt.input); err != nil || m != tt.want {
+			t.Errorf("on %q = %v, %v, want %d", tt.input, m, err, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		g          Grammar
+		input, err string
+	}{
+		{Decimal(2), "12.345", "Expected at most 2 fractional digits"},
+		{Decimal(2), "99999999999999999999", "out of range"},
+		{DecimalRounded(0), "9223372036854775807.5", "out of range"},
+	} {
+		sr := NewStringReader(tt.input)
+		_, err := tt.g(sr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) || sr.Pos() != 0 {
+			t.Errorf("on %q = %v at %d, want %q at 0", tt.input, err, sr.Pos(), tt.err)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package stateparser
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"regexp"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 type StateReader interface {
@@ -40,15 +45,245 @@ func Node(g Grammar, node func(interface{}) (interface{}, error)) Grammar {
 	}
 }
 
+// NodeSpan is like Node, but also passes node the span of input g matched.
+func NodeSpan(g Grammar, node func(m interface{}, span Span) (interface{}, error)) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		start := pos(sr)
+		m, err := g(sr)
+		if err != nil {
+			return nil, err
+		}
+		return node(m, Span{Start: start, End: pos(sr)})
+	}
+}
+
+// Repeated matches countG, whose match must be an int such as that of Int,
+// and then exactly that many itemG, returning their matches as a
+// []interface{}. This suits run-length prefixed data like 3(ab)(ab)(ab).
+func Repeated(countG, itemG Grammar) Grammar {
+	return Bind(countG, func(m interface{}) Grammar {
+		n, ok := m.(int)
+		if !ok || n < 0 {
+			return fail(fmt.Errorf("Expected a non-negative int repeat count, got %v", m))
+		}
+		return func(sr StateReader) (interface{}, error) {
+			ms := make([]interface{}, 0, n)
+			for len(ms) < n {
+				m, err := itemG(sr)
+				if err != nil {
+					if _, isFE := err.(fatalError); isFE {
+						return nil, err
+					}
+					return nil, fmt.Errorf("Expected %d repetitions, got %d: %s", n, len(ms), err)
+				}
+				ms = append(ms, m)
+			}
+			return ms, nil
+		}
+	})
+}
+
+// SubParse matches captureG, then runs inner over the text of its match as
+// if it were a separate input, returning inner's match. inner must consume
+// all of that text. This suits layered formats, such as a quoted string
+// whose contents have a grammar of their own. inner sees the captures, user
+// data and comments of the outer reader, and what it adds to them is kept
+// if it matches; the runes it reads count against the outer reader's
+// MaxSteps budget. Offsets reported inside inner, including those of the
+// comments it collects, are into the captured text.
+func SubParse(captureG Grammar, inner Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := captureG(sr)
+		if err != nil {
+			return nil, err
+		}
+		text := String(m)
+		isr := NewStringReader(text)
+		cs, shared := sharer(sr)
+		if shared {
+			isr.setSharedContext(cs.sharedContext())
+		}
+		m, err = inner(isr)
+		if shared {
+			cs.setSharedContext(isr.sharedContext())
+		}
+		if err == nil && isr.Pos() < len(text) {
+			err = fmt.Errorf("Expected end of inner input at offset %d", isr.Pos())
+		}
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+// ByteLenMatch pairs a match with the number of UTF-8 bytes it consumed.
+type ByteLenMatch struct {
+	Match interface{}
+	Len   int
+}
+
+// WithByteLen matches g and returns a ByteLenMatch recording how many bytes
+// (not runes) of input g consumed. The reader must implement Positioner.
+func WithByteLen(g Grammar) Grammar {
+	return NodeSpan(g, func(m interface{}, span Span) (interface{}, error) {
+		return ByteLenMatch{Match: m, Len: span.End - span.Start}, nil
+	})
+}
+
+// Bind runs g and passes its match to next to build the grammar that parses
+// what follows, allowing earlier input to drive later parsing.
+func Bind(g Grammar, next func(interface{}) Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := g(sr)
+		if err != nil {
+			return nil, err
+		}
+		m, err = next(m)(sr)
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+func fail(err error) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		return nil, err
+	}
+}
+
+// When runs g only if cond holds for the reader, and otherwise fails
+// without consuming anything. Together with reader-scoped state this allows
+// mode-sensitive grammars.
+func When(cond func(StateReader) bool, g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		if !cond(sr) {
+			return nil, fmt.Errorf("Condition not met")
+		}
+		return g(sr)
+	}
+}
+
+var errUnresolved = errors.New("Resolve of a grammar that was never assigned")
+
+// resolveTarget is a pointer handed to Resolve, with where Resolve was
+// called from so an unassigned one can be found.
+type resolveTarget struct {
+	g     *Grammar
+	where string
+}
+
+var (
+	resolveMu      sync.Mutex
+	resolveTargets []resolveTarget
+)
+
+// Resolve refers to the grammar *g at parse time, allowing recursive
+// grammars. If *g is still nil when the parse reaches it, the parse fails
+// with a fatal error rather than panicking. Every target is recorded so that
+// CheckResolved can find those never assigned.
 func Resolve(g *Grammar) Grammar {
+	where := "unknown location"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		where = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	resolveMu.Lock()
+	resolveTargets = append(resolveTargets, resolveTarget{g, where})
+	resolveMu.Unlock()
 	return func(sr StateReader) (interface{}, error) {
+		if *g == nil {
+			return nil, fatalError{errUnresolved}
+		}
 		return (*g)(sr)
 	}
 }
 
-func Set(set string) Grammar {
+// CheckResolved reports an error naming the first Resolve, in the order they
+// were made, whose target has not been assigned, catching a forgotten
+// assignment before any input is parsed. Call it once the grammar has been
+// fully built, for instance at the end of an init function. Grammars are
+// opaque functions and can't be walked, so every Resolve made so far is
+// checked, not just those reachable from one grammar.
+func CheckResolved() error {
+	resolveMu.Lock()
+	defer resolveMu.Unlock()
+	for _, t := range resolveTargets {
+		if t.g == nil || *t.g == nil {
+			return fmt.Errorf("Resolve at %s has an unassigned target", t.where)
+		}
+	}
+	return nil
+}
+
+// asciiMatches holds a single-rune string for each ASCII rune, already
+// boxed: converting a string to interface{} allocates, even a shared one.
+var asciiMatches [utf8.RuneSelf]interface{}
+
+func init() {
+	for i := range asciiMatches {
+		asciiMatches[i] = string(rune(i))
+	}
+}
+
+// runeString converts r to a string, sharing a preallocated string for ASCII
+// runes.
+func runeString(r rune) string {
+	if r >= 0 && r < utf8.RuneSelf {
+		return asciiMatches[r].(string)
+	}
+	return string(r)
+}
+
+// runeMatch is runeString for a match, returning the preallocated boxed
+// string for an ASCII rune so single-rune matchers don't allocate one.
+func runeMatch(r rune) interface{} {
+	if r >= 0 && r < utf8.RuneSelf {
+		return asciiMatches[r]
+	}
+	return string(r)
+}
+
+type runeRange struct {
+	lo, hi rune
+}
+
+// parseSet turns Set's class syntax into ranges. Every rune stands for
+// itself, except that a '-' between two runes denotes the inclusive range
+// between them.
+func parseSet(set string) []runeRange {
+	rs := []rune(set)
+	ranges := make([]runeRange, 0, len(rs))
+	for i := 0; i < len(rs); i++ {
+		if i+2 < len(rs) && rs[i+1] == '-' {
+			ranges = append(ranges, runeRange{rs[i], rs[i+2]})
+			i += 2
+			continue
+		}
+		ranges = append(ranges, runeRange{rs[i], rs[i]})
+	}
+	return ranges
+}
+
+func inRanges(ranges []runeRange, r rune) bool {
+	for _, rr := range ranges {
+		if r >= rr.lo && r <= rr.hi {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSet(set string, negate bool) Grammar {
+	ranges := parseSet(set)
 	set = Escaper.Replace(set)
-	regset, _ := regexp.Compile(fmt.Sprintf("[%s]", set))
 	return func(sr StateReader) (interface{}, error) {
 		state := sr.State()
 		r, _, err := sr.ReadRune()
@@ -56,16 +291,74 @@ func Set(set string) Grammar {
 			sr.RestoreState(state)
 			return nil, err
 		}
-		s := string([]rune{r})
-		if regset.MatchString(s) {
-			return s, nil
+		if inRanges(ranges, r) != negate {
+			return runeMatch(r), nil
+		}
+		sr.RestoreState(state)
+		if negate {
+			return nil, fmt.Errorf("Expected not \"%s\", got %q", set, runeString(r))
+		}
+		return nil, fmt.Errorf("Expected \"%s\", got %q", set, runeString(r))
+	}
+}
+
+// satisfy matches a single rune for which pred holds, returning it as a
+// string. desc describes the expected rune in the error.
+func satisfy(desc string, pred func(rune) bool) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		r, _, err := sr.ReadRune()
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		if pred(r) {
+			return runeMatch(r), nil
 		}
 		sr.RestoreState(state)
-		return nil, fmt.Errorf("Expected \"%s\", got %q", set, s)
+		return nil, fmt.Errorf("Expected %s, got %q", desc, r)
 	}
 }
 
+// Set matches a single rune from set. Each rune in set is taken literally,
+// including '^', ']', '[' and '\'; the only special syntax is a '-' between
+// two runes, which denotes the inclusive range between them ("a-z"). A '-'
+// at the start or end of set is literal.
+func Set(set string) Grammar {
+	return matchSet(set, false)
+}
+
+// NotSet matches a single rune that is not in set, using the same syntax as
+// Set.
+func NotSet(set string) Grammar {
+	return matchSet(set, true)
+}
+
+// SetExcept matches a single rune that is in include but not in exclude,
+// both in Set syntax, such as SetExcept("a-z", "xyz").
+func SetExcept(include, exclude string) Grammar {
+	in, ex := parseSet(include), parseSet(exclude)
+	desc := fmt.Sprintf("\"%s\" except \"%s\"", Escaper.Replace(include), Escaper.Replace(exclude))
+	return satisfy(desc, func(r rune) bool {
+		return inRanges(in, r) && !inRanges(ex, r)
+	})
+}
+
+// ExceptRune matches any single rune other than r. Like every rune
+// matcher, it fails at the end of input.
+func ExceptRune(r rune) Grammar {
+	return satisfy(fmt.Sprintf("any rune but %q", r), func(rr rune) bool {
+		return rr != r
+	})
+}
+
+// Lit matches text exactly. Lit panics if text is empty: an empty literal
+// would succeed without consuming input, which is almost always a mistake
+// and makes an unbounded Mult around it loop forever.
 func Lit(text string) Grammar {
+	if text == "" {
+		panic("stateparser: Lit called with empty text")
+	}
 	rs := []rune(text)
 	return func(sr StateReader) (interface{}, error) {
 		state := sr.State()
@@ -84,6 +377,211 @@ func Lit(text string) Grammar {
 	}
 }
 
+func LitIgnore(text string) Grammar {
+	return Ignore(Lit(text))
+}
+
+func SetIgnore(set string) Grammar {
+	return Ignore(Set(set))
+}
+
+// EOL matches a line ending, returning it normalized to "\n". By default
+// "\r\n", "\n" and "\r" are accepted; passing styles restricts it to those.
+// At the end of input EOL succeeds without consuming anything, still
+// returning "\n", so a file's last line needn't end in a line ending.
+func EOL(styles ...string) Grammar {
+	if len(styles) == 0 {
+		styles = []string{"\r\n", "\n", "\r"}
+	}
+	styles = append([]string(nil), styles...)
+	sort.SliceStable(styles, func(i, j int) bool {
+		return len(styles[i]) > len(styles[j])
+	})
+	lits := make([]Grammar, len(styles))
+	for i, style := range styles {
+		lits[i] = Lit(style)
+	}
+	nl := Or(lits...)
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		_, _, err := sr.ReadRune()
+		sr.RestoreState(state)
+		if err == io.EOF {
+			return "\n", nil
+		}
+		if _, err := nl(sr); err != nil {
+			return nil, err
+		}
+		return "\n", nil
+	}
+}
+
+// longestWord reads as far as any of words could still match and leaves sr
+// just past the longest word that did match, reporting whether there was one.
+// A fatal read error is returned as is.
+func longestWord(sr StateReader, words []string) (string, bool, error) {
+	start := sr.State()
+	live := make([][]rune, 0, len(words))
+	for _, w := range words {
+		live = append(live, []rune(w))
+	}
+	var best []rune
+	var bestState interface{}
+	found := false
+	for i := 0; len(live) > 0; i++ {
+		longer := live[:0]
+		for _, w := range live {
+			if len(w) == i {
+				best, bestState, found = w, sr.State(), true
+			} else {
+				longer = append(longer, w)
+			}
+		}
+		if len(longer) == 0 {
+			break
+		}
+		r, _, err := sr.ReadRune()
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return "", false, err
+			}
+			break
+		}
+		live = longer[:0]
+		for _, w := range longer {
+			if w[i] == r {
+				live = append(live, w)
+			}
+		}
+	}
+	if !found {
+		sr.RestoreState(start)
+		return "", false, nil
+	}
+	sr.RestoreState(bestState)
+	return string(best), true, nil
+}
+
+// LongestPrefix matches the longest of words found at the current position,
+// regardless of the order they are given in.
+func LongestPrefix(words ...string) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		w, ok, err := longestWord(sr, words)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("Expected one of %q", words)
+		}
+		return w, nil
+	}
+}
+
+// FromSlice is like LongestPrefix, but calls get for the candidate words
+// every time it runs, so the words can change while a grammar is in use.
+func FromSlice(get func() []string) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		words := get()
+		w, ok, err := longestWord(sr, words)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("Expected one of %q", words)
+		}
+		return w, nil
+	}
+}
+
+// Dispatch matches the longest key of m found at the current position and
+// returns the result of calling m's function for it, so each keyword can
+// build a fresh node of its own type.
+func Dispatch(m map[string]func() interface{}) Grammar {
+	words := make([]string, 0, len(m))
+	for w := range m {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return func(sr StateReader) (interface{}, error) {
+		w, ok, err := longestWord(sr, words)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("Expected one of %q", words)
+		}
+		return m[w](), nil
+	}
+}
+
+// Repeat matches between n and m runes for which pred holds, with m == 0
+// meaning no upper bound, and returns them as a string.
+func Repeat(n, m int, pred func(rune) bool) Grammar {
+	if m == 0 {
+		m = int(^uint(0) >> 1)
+	}
+	return func(sr StateReader) (interface{}, error) {
+		start := sr.State()
+		rs := []rune{}
+		for len(rs) < m {
+			state := sr.State()
+			r, _, err := sr.ReadRune()
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			if err != nil || !pred(r) {
+				sr.RestoreState(state)
+				break
+			}
+			rs = append(rs, r)
+		}
+		if len(rs) < n {
+			sr.RestoreState(start)
+			return nil, fmt.Errorf("Expected at least %d matching runes, got %d", n, len(rs))
+		}
+		return string(rs), nil
+	}
+}
+
+// CountRunes consumes the longest run of r at the current position and
+// returns its length as an int. A run of length zero is a successful match.
+func CountRunes(r rune) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		count := 0
+		for {
+			state := sr.State()
+			rr, _, err := sr.ReadRune()
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			if err != nil || rr != r {
+				sr.RestoreState(state)
+				return count, nil
+			}
+			count++
+		}
+	}
+}
+
+// SkipRunes consumes exactly n runes of any kind and returns nil, failing
+// without consuming anything if fewer than n remain.
+func SkipRunes(n int) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		for i := 0; i < n; i++ {
+			_, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Expected %d more runes, got end of input", n-i)
+			}
+		}
+		return nil, nil
+	}
+}
+
 func And(gs ...Grammar) Grammar {
 	return func(sr StateReader) (interface{}, error) {
 		state := sr.State()
@@ -102,6 +600,69 @@ func And(gs ...Grammar) Grammar {
 	}
 }
 
+// AndStruct is like And, but its result always has exactly len(gs)
+// elements, element i being the match of gs[i]. And drops nil matches, such
+// as those of Ignore, which shifts the positions of later elements;
+// AndStruct keeps them so matches can be picked out by index.
+func AndStruct(gs ...Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		matches := make([]interface{}, len(gs))
+		for i, g := range gs {
+			m, err := g(sr)
+			if err != nil {
+				sr.RestoreState(state)
+				return nil, err
+			}
+			matches[i] = m
+		}
+		return matches, nil
+	}
+}
+
+// Pick matches gs in sequence like AndStruct, but returns only the match of
+// gs[index]. A negative index counts from the end, so -1 picks the last.
+func Pick(index int, gs ...Grammar) Grammar {
+	if index < 0 {
+		index += len(gs)
+	}
+	if index < 0 || index >= len(gs) {
+		panic("stateparser: Pick index out of range")
+	}
+	return Node(AndStruct(gs...), func(m interface{}) (interface{}, error) {
+		return m.([]interface{})[index], nil
+	})
+}
+
+// AndCommitting is like And, but commits once its first sub-grammar has
+// matched: a failure of any later sub-grammar is fatal. A failure of the
+// first is an ordinary failure, so alternatives can still be tried. This
+// suits productions that can be recognised from their first element, and
+// unlike Require does not make the whole sequence fatal up front.
+func AndCommitting(gs ...Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		matches := make([]interface{}, 0, len(gs))
+		for i, g := range gs {
+			m, err := g(sr)
+			if err != nil {
+				if i == 0 {
+					sr.RestoreState(state)
+					return nil, err
+				}
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				return nil, fatalError{err}
+			}
+			if m != nil {
+				matches = append(matches, m)
+			}
+		}
+		return matches, nil
+	}
+}
+
 func Or(gs ...Grammar) Grammar {
 	return func(sr StateReader) (interface{}, error) {
 		state := sr.State()
@@ -117,10 +678,167 @@ func Or(gs ...Grammar) Grammar {
 			errs = append(errs, err)
 			sr.RestoreState(state)
 		}
+		if ee, ok := mergeExpected(errs); ok {
+			return nil, ee
+		}
 		return nil, fmt.Errorf("Or error, expected: (%v)", errs)
 	}
 }
 
+// OrLimited is like Or, but only ever tries the first max alternatives. It
+// is mostly useful for debugging and performance experiments.
+func OrLimited(max int, gs ...Grammar) Grammar {
+	if max < 0 {
+		max = 0
+	}
+	if max < len(gs) {
+		gs = gs[:max]
+	}
+	return Or(gs...)
+}
+
+// PriorityAlt is an alternative for OrPriority.
+type PriorityAlt struct {
+	Priority int
+	Grammar  Grammar
+}
+
+// OrPriority is like Or, but tries the alternatives in order of decreasing
+// Priority, keeping the given order between equal priorities, so the result
+// doesn't depend on how the alternatives were collected.
+func OrPriority(alts ...PriorityAlt) Grammar {
+	sorted := append([]PriorityAlt(nil), alts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	gs := make([]Grammar, len(sorted))
+	for i, alt := range sorted {
+		gs[i] = alt.Grammar
+	}
+	return Or(gs...)
+}
+
+// SpanMatch is the outcome of one grammar run by Both: its match and span
+// on success, or the error it failed with.
+type SpanMatch struct {
+	Match interface{}
+	Span  Span
+	Err   error
+}
+
+// BothMatch is the result of Both.
+type BothMatch struct {
+	First, Second SpanMatch
+}
+
+// Both runs g1 and g2 from the same position and returns a BothMatch with
+// the outcome of each, rather than choosing between them, for ambiguity
+// analysis. It consumes nothing, and fails only if both grammars fail.
+func Both(g1, g2 Grammar) Grammar {
+	run := func(sr StateReader, g Grammar) (SpanMatch, error) {
+		state := sr.State()
+		start := pos(sr)
+		m, err := g(sr)
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return SpanMatch{}, err
+			}
+			sr.RestoreState(state)
+			return SpanMatch{Err: err, Span: Span{Start: start, End: start}}, nil
+		}
+		sm := SpanMatch{Match: m, Span: Span{Start: start, End: pos(sr)}}
+		sr.RestoreState(state)
+		return sm, nil
+	}
+	return func(sr StateReader) (interface{}, error) {
+		first, err := run(sr, g1)
+		if err != nil {
+			return nil, err
+		}
+		second, err := run(sr, g2)
+		if err != nil {
+			return nil, err
+		}
+		if first.Err != nil && second.Err != nil {
+			return nil, first.Err
+		}
+		return BothMatch{First: first, Second: second}, nil
+	}
+}
+
+type IndexedMatch struct {
+	Index int
+	Match interface{}
+}
+
+// OrIndexed is like Or, but returns an IndexedMatch recording which
+// alternative (counting from 0) matched along with its match.
+func OrIndexed(gs ...Grammar) Grammar {
+	alts := make([]Grammar, len(gs))
+	for i, g := range gs {
+		i := i
+		alts[i] = Node(g, func(m interface{}) (interface{}, error) {
+			return IndexedMatch{Index: i, Match: m}, nil
+		})
+	}
+	return Or(alts...)
+}
+
+// FirstAlt is an alternative for OrFirst. First lists, in Set syntax, the
+// runes Grammar can start with; an empty First means it may start with
+// anything, including the end of input.
+type FirstAlt struct {
+	First   string
+	Grammar Grammar
+}
+
+// OrFirst is like Or, but peeks at the next rune and skips alternatives
+// whose declared first set doesn't contain it, saving the cost of running
+// alternatives that are bound to fail.
+func OrFirst(alts ...FirstAlt) Grammar {
+	firsts := make([][]runeRange, len(alts))
+	for i, alt := range alts {
+		if alt.First != "" {
+			firsts[i] = parseSet(alt.First)
+		}
+	}
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		r, peekErr := peekRune(sr)
+		if _, isFE := peekErr.(fatalError); isFE {
+			return nil, peekErr
+		}
+		errs := []error{}
+		for i, alt := range alts {
+			if firsts[i] != nil && (peekErr != nil || !inRanges(firsts[i], r)) {
+				continue
+			}
+			m, err := alt.Grammar(sr)
+			if err == nil {
+				return m, nil
+			}
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			errs = append(errs, err)
+			sr.RestoreState(state)
+		}
+		if ee, ok := mergeExpected(errs); ok {
+			return nil, ee
+		}
+		if peekErr != nil {
+			errs = append(errs, peekErr)
+		} else if len(errs) == 0 {
+			errs = append(errs, fmt.Errorf("Unexpected %q", r))
+		}
+		return nil, fmt.Errorf("Or error, expected: (%v)", errs)
+	}
+}
+
+// Mult matches g between n and m times, with m == 0 meaning no upper bound.
+// If the reader tracks positions, Mult stops repeating once g matches
+// without consuming input and the minimum has been reached, since further
+// iterations would match the same empty input forever.
 func Mult(n, m int, g Grammar) Grammar {
 	if m == 0 {
 		m = int(^uint(0) >> 1)
@@ -129,6 +847,7 @@ func Mult(n, m int, g Grammar) Grammar {
 		state := sr.State()
 		ms := make([]interface{}, 0)
 		for i := 0; i < m; i++ {
+			before := pos(sr)
 			match, err := g(sr)
 			if err != nil {
 				if _, isFE := err.(fatalError); isFE {
@@ -141,15 +860,393 @@ func Mult(n, m int, g Grammar) Grammar {
 				return ms, nil
 			}
 			ms = append(ms, match)
+			if before >= 0 && pos(sr) == before && i+1 >= n {
+				break
+			}
 		}
 		return ms, nil
 	}
 }
 
+// MultLazy matches g between n and m times followed by rest, like
+// And(Mult(n, m, g), rest), but repeats g as few times as possible: after
+// the minimum it tries rest first and only matches another g if rest fails,
+// like a lazy quantifier in a regexp. Like Mult, it gives up once g matches
+// without consuming input past the minimum, rather than looping forever.
+func MultLazy(n, m int, g, rest Grammar) Grammar {
+	if m == 0 {
+		m = int(^uint(0) >> 1)
+	}
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		abort := func(err error) (interface{}, error) {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		ms := make([]interface{}, 0)
+		var restErr error
+		for {
+			if len(ms) >= n {
+				before := sr.State()
+				r, err := rest(sr)
+				if err == nil {
+					if r == nil {
+						return []interface{}{ms}, nil
+					}
+					return []interface{}{ms, r}, nil
+				}
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(before)
+				if len(ms) >= m {
+					return abort(err)
+				}
+				restErr = err
+			}
+			p := pos(sr)
+			match, err := g(sr)
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				return abort(err)
+			}
+			ms = append(ms, match)
+			if p >= 0 && pos(sr) == p && len(ms) > n {
+				// rest already failed here, and g can't move past it.
+				return abort(restErr)
+			}
+		}
+	}
+}
+
+// Many matches g zero or more times. Like Mult, it stops at a zero-width
+// match of g rather than looping forever.
+func Many(g Grammar) Grammar {
+	return Mult(0, 0, g)
+}
+
+// Many1 matches g one or more times. Like Mult, it stops at a zero-width
+// match of g rather than looping forever.
+func Many1(g Grammar) Grammar {
+	return Mult(1, 0, g)
+}
+
+// Fold matches g zero or more times, combining each match into an
+// accumulator with step as it goes, and returns the accumulator. Like Mult,
+// it stops at a zero-width match of g.
+func Fold(g Grammar, init interface{}, step func(acc, m interface{}) interface{}) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		acc := init
+		for {
+			before := pos(sr)
+			m, err := g(sr)
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				return acc, nil
+			}
+			acc = step(acc, m)
+			if before >= 0 && pos(sr) == before {
+				return acc, nil
+			}
+		}
+	}
+}
+
+// SepByN matches between n and m items separated by sep, with m == 0
+// meaning no upper bound, and returns the items without the separators. It
+// fails if fewer than n items are present, and also if another sep and item
+// follow the m-th item.
+func SepByN(n, m int, item, sep Grammar) Grammar {
+	if m == 0 {
+		m = int(^uint(0) >> 1)
+	}
+	next := func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		if _, err := sep(sr); err != nil {
+			return nil, err
+		}
+		m, err := item(sr)
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return m, nil
+	}
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		items := []interface{}{}
+		g := item
+		for len(items) < m {
+			match, err := g(sr)
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				break
+			}
+			items = append(items, match)
+			g = next
+		}
+		if len(items) < n {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Expected at least %d items, got %d", n, len(items))
+		}
+		if len(items) == m {
+			before := sr.State()
+			if _, err := next(sr); err == nil {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Expected at most %d items", m)
+			} else if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(before)
+		}
+		return items, nil
+	}
+}
+
+// Tuple matches open, then each of elems separated by sep, then close, and
+// returns a slice with exactly one match per element. Fewer or more
+// elements than len(elems) are reported as such.
+func Tuple(open, close, sep Grammar, elems ...Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		abort := func(err error) (interface{}, error) {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		// lookingAt reports whether g would match here, without consuming.
+		// It returns a fatal error from g as is.
+		lookingAt := func(g Grammar) (bool, error) {
+			s := sr.State()
+			done := speculate(sr)
+			_, err := g(sr)
+			if _, isFE := err.(fatalError); isFE {
+				return false, err
+			}
+			sr.RestoreState(s)
+			done()
+			return err == nil, nil
+		}
+		if _, err := open(sr); err != nil {
+			return abort(err)
+		}
+		matches := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			if i > 0 {
+				if _, err := sep(sr); err != nil {
+					atClose, ferr := lookingAt(close)
+					if ferr != nil {
+						return nil, ferr
+					}
+					if atClose {
+						return abort(fmt.Errorf("Expected %d elements, got %d", len(elems), i))
+					}
+					return abort(err)
+				}
+			}
+			m, err := elem(sr)
+			if err != nil {
+				return abort(err)
+			}
+			matches[i] = m
+		}
+		if _, err := close(sr); err != nil {
+			atSep, ferr := lookingAt(sep)
+			if ferr != nil {
+				return nil, ferr
+			}
+			if atSep {
+				return abort(fmt.Errorf("Expected %d elements, got more", len(elems)))
+			}
+			return abort(err)
+		}
+		return matches, nil
+	}
+}
+
+// SepBy matches zero or more items separated by sep, returning the items.
+func SepBy(item, sep Grammar) Grammar {
+	return SepByN(0, 0, item, sep)
+}
+
+type KV struct {
+	Key, Value string
+}
+
+// positionedKV is a KV along with the offset its key started at.
+type positionedKV struct {
+	KV
+	pos int
+}
+
+// pairs matches zero or more key, sep, value sequences.
+func pairs(key, sep, value Grammar) func(StateReader) ([]positionedKV, error) {
+	pair := func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		p := pos(sr)
+		k, err := key(sr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = sep(sr); err == nil {
+			var v interface{}
+			if v, err = value(sr); err == nil {
+				return positionedKV{KV{Key: String(k), Value: String(v)}, p}, nil
+			}
+		}
+		sr.RestoreState(state)
+		return nil, err
+	}
+	many := Many(pair)
+	return func(sr StateReader) ([]positionedKV, error) {
+		m, err := many(sr)
+		if err != nil {
+			return nil, err
+		}
+		ms := m.([]interface{})
+		kvs := make([]positionedKV, len(ms))
+		for i, mi := range ms {
+			kvs[i] = mi.(positionedKV)
+		}
+		return kvs, nil
+	}
+}
+
+// Pairs matches zero or more key, sep, value sequences and returns them in
+// input order as a []KV, keeping duplicate keys. Key and Value hold the text
+// of the key and value matches; anything that must come between pairs, such
+// as a line ending, belongs in value.
+func Pairs(key, sep, value Grammar) Grammar {
+	ps := pairs(key, sep, value)
+	return func(sr StateReader) (interface{}, error) {
+		pkvs, err := ps(sr)
+		if err != nil {
+			return nil, err
+		}
+		kvs := make([]KV, len(pkvs))
+		for i, pkv := range pkvs {
+			kvs[i] = pkv.KV
+		}
+		return kvs, nil
+	}
+}
+
+type mapConfig struct {
+	unique bool
+}
+
+// A MapOption configures ToMap.
+type MapOption func(*mapConfig)
+
+// UniqueKeys makes ToMap fail on a duplicate key, reporting the offsets of
+// both occurrences, instead of keeping the last value.
+func UniqueKeys() MapOption {
+	return func(mc *mapConfig) {
+		mc.unique = true
+	}
+}
+
+// ToMap matches the same input as Pairs but returns a map[string]string. By
+// default a later value for a key replaces an earlier one.
+func ToMap(key, sep, value Grammar, opts ...MapOption) Grammar {
+	mc := &mapConfig{}
+	for _, opt := range opts {
+		opt(mc)
+	}
+	ps := pairs(key, sep, value)
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		pkvs, err := ps(sr)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]string, len(pkvs))
+		seen := make(map[string]int, len(pkvs))
+		for _, pkv := range pkvs {
+			if first, dup := seen[pkv.Key]; dup && mc.unique {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Duplicate key '%s' at offset %d, first at offset %d", pkv.Key, pkv.pos, first)
+			}
+			seen[pkv.Key] = pkv.pos
+			m[pkv.Key] = pkv.Value
+		}
+		return m, nil
+	}
+}
+
 func Optional(g Grammar) Grammar {
 	return Mult(0, 1, g)
 }
 
+// OrError runs g, and if it fails non-fatally returns the placeholder built
+// by makeNode instead, consuming nothing, so that callers always get a tree.
+func OrError(g Grammar, makeNode func() interface{}) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := g(sr)
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			return makeNode(), nil
+		}
+		return m, nil
+	}
+}
+
+// OptionalMatch is the result of TryOptional. If Present is false, Err
+// holds the reason g didn't match.
+type OptionalMatch struct {
+	Match   interface{}
+	Present bool
+	Err     error
+}
+
+// TryOptional is like Optional, but returns an OptionalMatch so callers can
+// tell whether g matched and, if not, why. Unlike Optional it also catches
+// fatal errors from g, recording them in Err rather than aborting the parse.
+func TryOptional(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := g(sr)
+		if err != nil {
+			sr.RestoreState(state)
+			return OptionalMatch{Err: err}, nil
+		}
+		return OptionalMatch{Match: m, Present: true}, nil
+	}
+}
+
+// DefaultMatch is the result of OrDefault. Used reports whether Value is the
+// default rather than g's match.
+type DefaultMatch struct {
+	Value interface{}
+	Used  bool
+}
+
+// OrDefault matches g, or if g fails non-fatally matches nothing and uses
+// def instead, returning a DefaultMatch that tells the two apart.
+func OrDefault(g Grammar, def interface{}) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := g(sr)
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			return DefaultMatch{Value: def, Used: true}, nil
+		}
+		return DefaultMatch{Value: m}, nil
+	}
+}
+
 func Ignore(g Grammar) Grammar {
 	return func(sr StateReader) (interface{}, error) {
 		_, err := g(sr)
@@ -160,6 +1257,37 @@ func Ignore(g Grammar) Grammar {
 	}
 }
 
+// NonEmpty runs g and turns a match that consumed no input into a failure,
+// restoring state. Wrapping a grammar that can match empty, such as an
+// Optional, keeps it from silently succeeding inside an enclosing loop.
+func NonEmpty(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		before := pos(sr)
+		if before < 0 {
+			cr := &captureReader{StateReader: sr}
+			m, err := g(cr)
+			if err != nil {
+				return nil, err
+			}
+			if cr.buf.Len() == 0 {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Expected a non-empty match")
+			}
+			return m, nil
+		}
+		m, err := g(sr)
+		if err != nil {
+			return nil, err
+		}
+		if pos(sr) == before {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Expected a non-empty match")
+		}
+		return m, nil
+	}
+}
+
 func Require(gs ...Grammar) Grammar {
 	g := And(gs...)
 	return func(sr StateReader) (interface{}, error) {
@@ -239,6 +1367,8 @@ func String(m interface{}) string {
 			ss[i] = String(mi)
 		}
 		return strings.Join(ss, "")
+	case TaggedMatch:
+		return String(m.Match)
 	case string:
 		return m
 	}
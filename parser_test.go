@@ -0,0 +1,901 @@
+package stateparser
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMultLazy(t *testing.T) {
+	anyRune := NotSet("")
+	g := Capture(And(Lit("a"), MultLazy(0, 0, anyRune, Lit("b"))))
+	sr := NewStringReader("aXbYb")
+	m, err := g(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != "aXb" || sr.Pos() != 3 {
+		t.Errorf("lazy match = %q up to %d, want %q up to 3", m, sr.Pos(), "aXb")
+	}
+	greedy := Capture(And(Lit("a"), Many(anyRune)))
+	if m, _ := Parse(greedy, "aXbYb"); m != "aXbYb" {
+		t.Errorf("greedy match = %q", m)
+	}
+	if _, err := Parse(MultLazy(0, 1, anyRune, Lit("b")), "XYb"); err == nil {
+		t.Error("MultLazy exceeded its maximum")
+	}
+	if _, err := Parse(MultLazy(2, 0, anyRune, Lit("b")), "Xb"); err == nil {
+		t.Error("MultLazy stopped before its minimum")
+	}
+}
+
+func TestMultLazyZeroWidth(t *testing.T) {
+	g := MultLazy(0, 0, Optional(Lit("x")), Lit("y"))
+	if _, err := Parse(g, "z"); err == nil {
+		t.Error("MultLazy matched without rest")
+	}
+	if m, err := Parse(Capture(g), "xxy"); err != nil || m != "xxy" {
+		t.Errorf("match = %v, %v, want %q", m, err, "xxy")
+	}
+}
+
+func keywordAlts() ([]Grammar, []FirstAlt) {
+	var gs []Grammar
+	var alts []FirstAlt
+	for i := 0; i < 50; i++ {
+		kw := string(rune('A'+i%26)) + string(rune('a'+i/26)) + "kw"
+		g := Lit(kw)
+		gs = append(gs, g)
+		alts = append(alts, FirstAlt{First: kw[:1], Grammar: g})
+	}
+	return gs, alts
+}
+
+func TestOrFirst(t *testing.T) {
+	gs, alts := keywordAlts()
+	alts = append(alts, FirstAlt{Grammar: Optional(Lit("x"))})
+	or, orFirst := Many(Or(gs...)), Many(OrFirst(alts[:50]...))
+	for _, input := range []string{"Aakw", "XbkwWbkwAbkw", "Zakw", "AakwQ", "Abkw"} {
+		want, wantErr := Parse(AtEnd(or), input)
+		got, err := Parse(AtEnd(orFirst), input)
+		if (err == nil) != (wantErr == nil) || String(got) != String(want) {
+			t.Errorf("%q: OrFirst = %v, %v, Or = %v, %v", input, got, err, want, wantErr)
+		}
+	}
+	// An alternative with no first set is tried even at the end of input.
+	if m, err := Parse(OrFirst(alts[0], alts[50]), ""); err != nil || String(m) != "" {
+		t.Errorf("OrFirst at end = %v, %v", m, err)
+	}
+	if _, err := Parse(OrFirst(alts[0]), "Q"); err == nil {
+		t.Error("OrFirst matched a rune outside every first set")
+	}
+}
+
+func benchmarkKeywords(b *testing.B, g Grammar) {
+	input := strings.Repeat("XbkwWbkwZakw", 100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(AtEnd(Many(g)), input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOr50(b *testing.B) {
+	gs, _ := keywordAlts()
+	benchmarkKeywords(b, Or(gs...))
+}
+
+func BenchmarkOrFirst50(b *testing.B) {
+	_, alts := keywordAlts()
+	benchmarkKeywords(b, OrFirst(alts...))
+}
+
+func TestRuneString(t *testing.T) {
+	for _, r := range []rune{0, 'a', 0x7f, 0x80, 'é', '世'} {
+		if s := runeString(r); s != string(r) {
+			t.Errorf("runeString(%q) = %q", r, s)
+		}
+	}
+	// The rune is computed so the compiler can't box a constant up front.
+	r := rune('a' + len(t.Name())%26)
+	var m interface{}
+	allocs := testing.AllocsPerRun(100, func() {
+		m = runeMatch(r)
+	})
+	if allocs != 0 {
+		t.Errorf("runeMatch allocated %v times for an ASCII rune", allocs)
+	}
+	if m != string(r) || runeMatch('é') != "é" {
+		t.Errorf("runeMatch = %q, %q", m, runeMatch('é'))
+	}
+}
+
+func BenchmarkIdentifiers(b *testing.B) {
+	ident := And(Set("a-zA-Z_"), Many(Set("a-zA-Z0-9_")))
+	g := AtEnd(Many(And(ident, Optional(Lit(" ")))))
+	input := strings.Repeat("foo bar_baz x1 quux42 ", 1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(g, input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStringTagged(t *testing.T) {
+	word := Mult(1, 0, Set("a-z"))
+	g := And(Tag("key", word), Lit("="), Tag("value", And(Tag("head", Set("0-9")), Many(Set("0-9")))))
+	m, err := Parse(g, "port=8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := String(m); s != "port=8080" {
+		t.Errorf("String = %q, want %q", s, "port=8080")
+	}
+}
+
+func TestLitIgnore(t *testing.T) {
+	num := Mult(1, 0, Set("0-9"))
+	g := And(LitIgnore("("), num, LitIgnore(","), SetIgnore(" \t"), num, LitIgnore(")"))
+	m, err := Parse(g, "(12,\t34)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, ok := m.([]interface{})
+	if !ok || len(ms) != 2 || String(ms[0]) != "12" || String(ms[1]) != "34" {
+		t.Errorf("And = %#v, want only the two numbers", m)
+	}
+	if _, err := Parse(g, "(12;34)"); err == nil {
+		t.Error("LitIgnore matched the wrong separator")
+	}
+}
+
+func TestEOL(t *testing.T) {
+	tests := []struct {
+		g     Grammar
+		input string
+		want  interface{}
+		pos   int
+	}{
+		{EOL(), "\r\nx", "\n", 2},
+		{EOL(), "\nx", "\n", 1},
+		{EOL(), "\rx", "\n", 1},
+		{EOL(), "\n\r", "\n", 1},
+		{EOL(), "", "\n", 0},
+		{EOL("\n"), "\n", "\n", 1},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := tt.g(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.pos {
+			t.Errorf("EOL on %q = %#v, %v up to %d, want %#v up to %d", tt.input, m, err, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, input := range []string{"x", " \n"} {
+		if _, err := Parse(EOL(), input); err == nil {
+			t.Errorf("EOL matched %q", input)
+		}
+	}
+	if _, err := Parse(EOL("\n"), "\r\n"); err == nil {
+		t.Error(`EOL("\n") matched "\r\n"`)
+	}
+	// The match is a string at the end of input too.
+	g := Node(EOL(), func(m interface{}) (interface{}, error) {
+		return len(m.(string)), nil
+	})
+	if m, err := Parse(And(Lit("a"), g), "a"); err != nil || !reflect.DeepEqual(m, []interface{}{"a", 1}) {
+		t.Errorf("EOL at the end of input = %#v, %v", m, err)
+	}
+}
+
+func TestLitEmpty(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Lit(\"\") did not panic")
+		}
+	}()
+	Lit("")
+}
+
+func TestCountRunes(t *testing.T) {
+	indent := CountRunes(' ')
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"    x = 1", 4},
+		{"x", 0},
+		{"", 0},
+		{"  \t y", 2},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := indent(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.want {
+			t.Errorf("CountRunes on %q = %v, %v up to %d, want %d", tt.input, m, err, sr.Pos(), tt.want)
+		}
+	}
+}
+
+func TestSetLiteral(t *testing.T) {
+	tests := []struct {
+		set   string
+		match string
+		miss  string
+	}{
+		{"]", "]", "["},
+		{"\\", "\\", "n"},
+		{"^a", "^", "b"},
+		{"^a", "a", "b"},
+		{"a-c", "b", "-"},
+		{"-a", "-", "b"},
+		{"a-", "-", "b"},
+		{"[]", "[", "a"},
+		{"\n\t", "\t", "n"},
+	}
+	for _, tt := range tests {
+		if m, err := Parse(Set(tt.set), tt.match); err != nil || m != tt.match {
+			t.Errorf("Set(%q) on %q = %v, %v", tt.set, tt.match, m, err)
+		}
+		if _, err := Parse(Set(tt.set), tt.miss); err == nil {
+			t.Errorf("Set(%q) matched %q", tt.set, tt.miss)
+		}
+		if _, err := Parse(NotSet(tt.set), tt.match); err == nil {
+			t.Errorf("NotSet(%q) matched %q", tt.set, tt.match)
+		}
+	}
+}
+
+func TestLongestPrefix(t *testing.T) {
+	sr := NewStringReader("abcd")
+	m, err := LongestPrefix("ab", "abc", "a")(sr)
+	if err != nil || m != "abc" || sr.Pos() != 3 {
+		t.Errorf("LongestPrefix = %v, %v up to %d, want %q up to 3", m, err, sr.Pos(), "abc")
+	}
+	sr = NewStringReader("abx")
+	if m, err := LongestPrefix("abc", "a")(sr); err != nil || m != "a" || sr.Pos() != 1 {
+		t.Errorf("LongestPrefix = %v, %v up to %d, want %q up to 1", m, err, sr.Pos(), "a")
+	}
+	sr = NewStringReader("xyz")
+	if _, err := LongestPrefix("ab", "abc")(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("LongestPrefix = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestBind(t *testing.T) {
+	length := And(Mult(1, 0, Set("0-9")), LitIgnore(":"))
+	g := Bind(length, func(m interface{}) Grammar {
+		n, err := strconv.Atoi(String(m))
+		if err != nil {
+			return fail(err)
+		}
+		return Capture(Mult(n, n, NotSet("")))
+	})
+	sr := NewStringReader("5:hello world")
+	m, err := g(sr)
+	if err != nil || m != "hello" || sr.Pos() != 7 {
+		t.Errorf("Bind = %v, %v up to %d, want %q up to 7", m, err, sr.Pos(), "hello")
+	}
+	sr = NewStringReader("9:short")
+	if _, err := g(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("Bind = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+type errorNode struct{}
+
+func TestOrError(t *testing.T) {
+	word := Mult(1, 0, Set("a-z"))
+	clause := OrError(And(LitIgnore(" where "), word), func() interface{} { return errorNode{} })
+	g := And(LitIgnore("select "), word, clause)
+
+	m, err := Parse(g, "select x where y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms := m.([]interface{}); len(ms) != 2 || String(ms[1]) != "y" {
+		t.Errorf("with clause = %#v", m)
+	}
+	sr := NewStringReader("select x wher")
+	m, err = g(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms := m.([]interface{}); len(ms) != 2 || ms[1] != (errorNode{}) || sr.Pos() != 8 {
+		t.Errorf("missing clause = %#v up to %d, want placeholder up to 8", m, sr.Pos())
+	}
+	if _, err := Parse(OrError(Many(Lit("a")), func() interface{} { return errorNode{} }), "aaaa", MaxSteps(2)); err == nil {
+		t.Error("OrError swallowed a fatal error")
+	}
+}
+
+func TestExceptRune(t *testing.T) {
+	quoted := And(LitIgnore("'"), Capture(Many(ExceptRune('\''))), LitIgnore("'"))
+	m, err := Parse(quoted, "'it is''")
+	if err != nil || m.([]interface{})[0] != "it is" {
+		t.Errorf("quoted body = %#v, %v", m, err)
+	}
+	if _, err := Parse(quoted, "'open"); err == nil {
+		t.Error("unterminated quote matched")
+	}
+	for _, input := range []string{"'", ""} {
+		sr := NewStringReader(input)
+		if _, err := ExceptRune('\'')(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("ExceptRune on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+}
+
+func TestMany(t *testing.T) {
+	tests := []struct {
+		g     Grammar
+		input string
+		n     int
+		ok    bool
+	}{
+		{Many(Lit("a")), "aaab", 3, true},
+		{Many(Lit("a")), "b", 0, true},
+		{Many1(Lit("a")), "aab", 2, true},
+		{Many1(Lit("a")), "b", 0, false},
+		{Mult(2, 3, Lit("a")), "aaaa", 3, true},
+		{Mult(2, 3, Lit("a")), "ab", 0, false},
+		// A zero-width match ends the repetition instead of looping.
+		{Many(Optional(Lit("a"))), "aab", 3, true},
+		{Many1(Many(Lit("x"))), "y", 1, true},
+	}
+	for i, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := tt.g(sr)
+		if (err == nil) != tt.ok {
+			t.Errorf("%d: err = %v, want success %v", i, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			if sr.Pos() != 0 {
+				t.Errorf("%d: failed at %d, want 0", i, sr.Pos())
+			}
+			continue
+		}
+		if ms := m.([]interface{}); len(ms) != tt.n {
+			t.Errorf("%d: %d matches, want %d", i, len(ms), tt.n)
+		}
+	}
+}
+
+func TestOrIndexed(t *testing.T) {
+	g := OrIndexed(Lit("GET"), Lit("PUT"), Lit("POST"), Lit("P"))
+	for _, tt := range []struct {
+		input string
+		index int
+		match string
+	}{
+		{"GET /", 0, "GET"},
+		{"PUT /", 1, "PUT"},
+		{"POST /", 2, "POST"},
+		{"PATCH /", 3, "P"},
+	} {
+		m, err := Parse(g, tt.input)
+		im, ok := m.(IndexedMatch)
+		if err != nil || !ok || im.Index != tt.index || im.Match != tt.match {
+			t.Errorf("on %q = %#v, %v, want index %d", tt.input, m, err, tt.index)
+		}
+	}
+	if _, err := Parse(g, "DELETE"); err == nil {
+		t.Error("OrIndexed matched with no alternative")
+	}
+}
+
+func TestFromSlice(t *testing.T) {
+	words := []string{"print"}
+	g := FromSlice(func() []string { return words })
+	if _, err := Parse(g, "println(x)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(g, "sum(x)"); err == nil {
+		t.Error("FromSlice matched a word not yet defined")
+	}
+	words = append(words, "println", "sum")
+	if m, err := Parse(g, "println(x)"); err != nil || m != "println" {
+		t.Errorf("after update = %v, %v, want %q", m, err, "println")
+	}
+	if m, err := Parse(g, "sum(x)"); err != nil || m != "sum" {
+		t.Errorf("after update = %v, %v, want %q", m, err, "sum")
+	}
+}
+
+func TestNodeSpan(t *testing.T) {
+	var spans []Span
+	word := NodeSpan(Capture(Many1(Set("a-zé"))), func(m interface{}, span Span) (interface{}, error) {
+		spans = append(spans, span)
+		return m, nil
+	})
+	if _, err := Parse(And(word, Lit(" "), word), "héllo world"); err != nil {
+		t.Fatal(err)
+	}
+	want := []Span{{0, 6}, {7, 12}}
+	if len(spans) != 2 || spans[0] != want[0] || spans[1] != want[1] {
+		t.Errorf("spans = %v, want %v", spans, want)
+	}
+}
+
+func TestFold(t *testing.T) {
+	digit := Node(Set("0-9"), func(m interface{}) (interface{}, error) {
+		return int(m.(string)[0] - '0'), nil
+	})
+	number := Fold(digit, 0, func(acc, m interface{}) interface{} {
+		return acc.(int)*10 + m.(int)
+	})
+	sr := NewStringReader("40721x")
+	m, err := number(sr)
+	if err != nil || m != 40721 || sr.Pos() != 5 {
+		t.Errorf("Fold = %v, %v up to %d, want 40721 up to 5", m, err, sr.Pos())
+	}
+	if m, err := Parse(number, "x"); err != nil || m != 0 {
+		t.Errorf("Fold with no matches = %v, %v, want the initial value", m, err)
+	}
+}
+
+func TestSepByN(t *testing.T) {
+	coord := SepByN(2, 2, Int(), Lit(","))
+	sr := NewStringReader("3,4)")
+	m, err := coord(sr)
+	if err != nil || len(m.([]interface{})) != 2 || m.([]interface{})[1] != 4 || sr.Pos() != 3 {
+		t.Errorf("SepByN on two = %#v, %v up to %d", m, err, sr.Pos())
+	}
+	sr = NewStringReader("3)")
+	if _, err := coord(sr); err == nil || err.Error() != "Expected at least 2 items, got 1" || sr.Pos() != 0 {
+		t.Errorf("SepByN on one = %v at %d", err, sr.Pos())
+	}
+	sr = NewStringReader("3,4,5")
+	if _, err := coord(sr); err == nil || err.Error() != "Expected at most 2 items" || sr.Pos() != 0 {
+		t.Errorf("SepByN on three = %v at %d", err, sr.Pos())
+	}
+	// A trailing separator without an item is left for the caller.
+	sr = NewStringReader("3,4,")
+	if _, err := coord(sr); err != nil || sr.Pos() != 3 {
+		t.Errorf("SepByN with trailing separator = %v up to %d", err, sr.Pos())
+	}
+	if m, err := Parse(SepBy(Int(), Lit(",")), ""); err != nil || len(m.([]interface{})) != 0 {
+		t.Errorf("SepBy on empty input = %#v, %v", m, err)
+	}
+}
+
+func TestOrLimited(t *testing.T) {
+	tried := 0
+	counted := func(g Grammar) Grammar {
+		return func(sr StateReader) (interface{}, error) {
+			tried++
+			return g(sr)
+		}
+	}
+	g := OrLimited(2, counted(Lit("a")), counted(Lit("b")), counted(Lit("c")), counted(Lit("d")))
+	if m, err := Parse(g, "b"); err != nil || m != "b" {
+		t.Errorf("OrLimited on %q = %v, %v", "b", m, err)
+	}
+	tried = 0
+	if _, err := Parse(g, "c"); err == nil {
+		t.Error("OrLimited matched an alternative past its limit")
+	}
+	if tried != 2 {
+		t.Errorf("OrLimited tried %d alternatives, want 2", tried)
+	}
+}
+
+func TestWhen(t *testing.T) {
+	raw := false
+	word := When(func(StateReader) bool { return !raw }, Capture(Many1(Set("a-z"))))
+	if m, err := Parse(word, "abc"); err != nil || m != "abc" {
+		t.Errorf("When with cond = %v, %v", m, err)
+	}
+	raw = true
+	sr := NewStringReader("abc")
+	if _, err := word(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("When without cond = %v at %d, want failure at 0", err, sr.Pos())
+	}
+	atStart := When(func(sr StateReader) bool { return pos(sr) == 0 }, Lit("a"))
+	if _, err := Parse(Many1(atStart), "aa"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(And(Lit("a"), atStart), "aa"); err == nil {
+		t.Error("When ran g with cond false")
+	}
+}
+
+func TestTryOptional(t *testing.T) {
+	g := TryOptional(Label("suffix", And(Lit("."), Set("a-z"))))
+	m, err := Parse(g, ".x")
+	if om, ok := m.(OptionalMatch); err != nil || !ok || !om.Present || String(om.Match) != ".x" {
+		t.Errorf("TryOptional present = %#v, %v", m, err)
+	}
+	sr := NewStringReader(".1")
+	m, err = g(sr)
+	om, ok := m.(OptionalMatch)
+	if err != nil || !ok || om.Present || sr.Pos() != 0 {
+		t.Fatalf("TryOptional absent = %#v, %v up to %d", m, err, sr.Pos())
+	}
+	if ee, ok := om.Err.(ExpectedError); !ok || ee.Expected[0] != "suffix" {
+		t.Errorf("Err = %#v, want the suffix ExpectedError", om.Err)
+	}
+
+	// Fatal errors are caught and recorded too.
+	m, err = Parse(TryOptional(Many(Lit("a"))), "aaaa", MaxSteps(2))
+	if om, ok := m.(OptionalMatch); err != nil || !ok || om.Present || !strings.Contains(om.Err.Error(), "Step limit") {
+		t.Errorf("TryOptional on fatal error = %#v, %v", m, err)
+	}
+}
+
+func TestPairs(t *testing.T) {
+	name := Capture(Many1(Set("A-Za-z-")))
+	value := And(Capture(Many(NotSet("\r\n"))), LitIgnore("\r\n"))
+	g := Pairs(name, Lit(": "), value)
+	input := "Host: example.com\r\nAccept: text/html\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n\r\nbody"
+	sr := NewStringReader(input)
+	m, err := g(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KV{
+		{"Host", "example.com"},
+		{"Accept", "text/html"},
+		{"Set-Cookie", "a=1"},
+		{"Set-Cookie", "b=2"},
+	}
+	if got := m.([]KV); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pairs = %v, want %v", got, want)
+	}
+	if rest := input[sr.Pos():]; rest != "\r\nbody" {
+		t.Errorf("Pairs left %q, want %q", rest, "\r\nbody")
+	}
+}
+
+func TestAndStruct(t *testing.T) {
+	digits := Many(Set("0-9"))
+	g := AndStruct(LitIgnore("#"), digits, Optional(Lit("!")), Lit(";"))
+	m, err := Parse(g, "#123;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := m.([]interface{})
+	if len(ms) != 4 {
+		t.Fatalf("AndStruct = %#v, want 4 elements", m)
+	}
+	if ms[0] != nil || String(ms[1]) != "123" || len(ms[1].([]interface{})) != 3 || ms[3] != ";" {
+		t.Errorf("AndStruct = %#v", m)
+	}
+	sr := NewStringReader("#12")
+	if _, err := g(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("AndStruct = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	hex := Repeat(2, 4, unhexOK)
+	tests := []struct {
+		input, want string
+		ok          bool
+	}{
+		{"ff", "ff", true},
+		{"1aB", "1aB", true},
+		{"dead", "dead", true},
+		{"beefy", "beef", true},
+		{"f", "", false},
+		{"xy", "", false},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := hex(sr)
+		if (err == nil) != tt.ok || tt.ok && (m != tt.want || sr.Pos() != len(tt.want)) || !tt.ok && sr.Pos() != 0 {
+			t.Errorf("Repeat on %q = %v, %v up to %d, want %q", tt.input, m, err, sr.Pos(), tt.want)
+		}
+	}
+}
+
+func unhexOK(r rune) bool {
+	_, ok := unhex(r)
+	return ok
+}
+
+func TestCheckResolved(t *testing.T) {
+	var expr, term Grammar
+	expr = Or(And(Lit("("), Resolve(&term), Lit(")")), Lit("x"))
+	err := CheckResolved()
+	if err == nil || !strings.HasPrefix(err.Error(), "Resolve at parser_test.go:") {
+		t.Errorf("CheckResolved = %v, want the unassigned Resolve", err)
+	}
+	if _, err := Parse(expr, "(x)"); err == nil {
+		t.Error("parse through an unassigned Resolve succeeded")
+	}
+	term = Resolve(&expr)
+	if err := CheckResolved(); err != nil {
+		t.Errorf("CheckResolved = %v", err)
+	}
+	if _, err := Parse(expr, "((x))"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetExcept(t *testing.T) {
+	g := SetExcept("a-z", "xyz")
+	for _, s := range []string{"a", "m", "w"} {
+		if m, err := Parse(g, s); err != nil || m != s {
+			t.Errorf("SetExcept on %q = %v, %v", s, m, err)
+		}
+	}
+	for _, s := range []string{"x", "y", "z", "A", ""} {
+		sr := NewStringReader(s)
+		if _, err := g(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("SetExcept on %q = %v at %d, want failure at 0", s, err, sr.Pos())
+		}
+	}
+}
+
+func TestOrDefault(t *testing.T) {
+	g := OrDefault(Int(), 0)
+	sr := NewStringReader("0")
+	m, err := g(sr)
+	if dm, ok := m.(DefaultMatch); err != nil || !ok || dm.Value != 0 || dm.Used || sr.Pos() != 1 {
+		t.Errorf("OrDefault on %q = %#v, %v up to %d", "0", m, err, sr.Pos())
+	}
+	sr = NewStringReader("x")
+	m, err = g(sr)
+	if dm, ok := m.(DefaultMatch); err != nil || !ok || dm.Value != 0 || !dm.Used || sr.Pos() != 0 {
+		t.Errorf("OrDefault on %q = %#v, %v up to %d", "x", m, err, sr.Pos())
+	}
+}
+
+func TestAndCommitting(t *testing.T) {
+	let := AndCommitting(Lit("let "), Capture(Many1(Set("a-z"))), Lit(" = "), Int())
+	g := Or(let, Capture(Many1(NotSet(""))))
+
+	if m, err := Parse(g, "let x = 1"); err != nil || len(m.([]interface{})) != 4 {
+		t.Errorf("AndCommitting = %#v, %v", m, err)
+	}
+	// A failure of the first element lets Or try the next alternative.
+	if m, err := Parse(g, "print x"); err != nil || m != "print x" {
+		t.Errorf("Or after first element failed = %v, %v", m, err)
+	}
+	// Once "let " has matched, a later failure is fatal and Or gives up.
+	if _, err := Parse(g, "let x == 1"); err == nil {
+		t.Error("mid-sequence failure fell through to the next alternative")
+	}
+	if _, err := Many(let)(NewStringReader("let x = 1let y")); err == nil {
+		t.Error("Many swallowed a mid-sequence failure")
+	} else if _, isFE := err.(fatalError); !isFE {
+		t.Errorf("error = %#v, want it fatal", err)
+	}
+}
+
+func TestOrPriority(t *testing.T) {
+	g := OrPriority(
+		PriorityAlt{Priority: 0, Grammar: Lit("a")},
+		PriorityAlt{Priority: 1, Grammar: Node(Lit("a"), func(interface{}) (interface{}, error) { return "one", nil })},
+		PriorityAlt{Priority: 5, Grammar: Node(Lit("ab"), func(interface{}) (interface{}, error) { return "five", nil })},
+		PriorityAlt{Priority: 1, Grammar: Node(Lit("a"), func(interface{}) (interface{}, error) { return "one again", nil })},
+	)
+	if m, err := Parse(g, "ab"); err != nil || m != "five" {
+		t.Errorf("OrPriority on %q = %v, %v, want the last, highest priority alternative", "ab", m, err)
+	}
+	// Equal priorities keep their given order.
+	if m, err := Parse(g, "a"); err != nil || m != "one" {
+		t.Errorf("OrPriority on %q = %v, %v, want %q", "a", m, err, "one")
+	}
+}
+
+func TestToMapDuplicateKeys(t *testing.T) {
+	key := Capture(Many1(Set("a-z")))
+	value := And(Capture(Many(NotSet(";"))), LitIgnore(";"))
+	input := "x=1;y=2;x=3;"
+	m, err := Parse(ToMap(key, Lit("="), value), input)
+	if want := map[string]string{"x": "3", "y": "2"}; err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("ToMap = %v, %v, want %v", m, err, want)
+	}
+	sr := NewStringReader(input)
+	_, err = ToMap(key, Lit("="), value, UniqueKeys())(sr)
+	if err == nil || err.Error() != "Duplicate key 'x' at offset 8, first at offset 0" || sr.Pos() != 0 {
+		t.Errorf("ToMap with UniqueKeys = %v at %d", err, sr.Pos())
+	}
+	if _, err := Parse(ToMap(key, Lit("="), value, UniqueKeys()), "x=1;y=2;"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTuple(t *testing.T) {
+	sep := And(Lit(","), Many(Lit(" ")))
+	pair := Tuple(Lit("("), Lit(")"), sep, Int(), Int())
+	m, err := Parse(pair, "(1, 2)")
+	if err != nil || !reflect.DeepEqual(m, []interface{}{1, 2}) {
+		t.Errorf("Tuple = %#v, %v", m, err)
+	}
+	for _, tt := range []struct{ input, err string }{
+		{"(1, 2, 3)", "Expected 2 elements, got more"},
+		{"(1)", "Expected 2 elements, got 1"},
+		{"(1, x)", ""},
+		{"1, 2", ""},
+	} {
+		sr := NewStringReader(tt.input)
+		_, err := pair(sr)
+		if err == nil || tt.err != "" && err.Error() != tt.err || sr.Pos() != 0 {
+			t.Errorf("Tuple on %q = %v at %d, want %q at 0", tt.input, err, sr.Pos(), tt.err)
+		}
+	}
+}
+
+func TestWithByteLen(t *testing.T) {
+	g := WithByteLen(Capture(Many1(NotSet(" "))))
+	for _, tt := range []struct {
+		input, match string
+		n            int
+	}{
+		{"abc def", "abc", 3},
+		{"é世 x", "é世", 5},
+		{"😀", "😀", 4},
+	} {
+		m, err := Parse(g, tt.input)
+		bm, ok := m.(ByteLenMatch)
+		if err != nil || !ok || bm.Match != tt.match || bm.Len != tt.n {
+			t.Errorf("WithByteLen on %q = %#v, %v, want %d bytes", tt.input, m, err, tt.n)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	word := Capture(Many1(Set("a-z")))
+	if m, err := Parse(Pick(1, Lit("( "), word, Lit(" )")), "( x )"); err != nil || m != "x" {
+		t.Errorf("Pick(1) = %v, %v", m, err)
+	}
+	if m, err := Parse(Pick(-1, Lit("a"), Lit("b"), Lit("c")), "abc"); err != nil || m != "c" {
+		t.Errorf("Pick(-1) = %v, %v", m, err)
+	}
+	sr := NewStringReader("( x ]")
+	if _, err := Pick(1, Lit("( "), word, Lit(" )"))(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("Pick = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestSkipRunes(t *testing.T) {
+	g := And(SkipRunes(4), Capture(Rest()))
+	if m, err := Parse(g, "HDR\x00payload"); err != nil || !reflect.DeepEqual(m, []interface{}{"payload"}) {
+		t.Errorf("SkipRunes = %#v, %v", m, err)
+	}
+	if m, err := Parse(g, "é世😀!x"); err != nil || !reflect.DeepEqual(m, []interface{}{"x"}) {
+		t.Errorf("SkipRunes over multi-byte runes = %#v, %v", m, err)
+	}
+	sr := NewStringReader("abc")
+	if _, err := SkipRunes(4)(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("SkipRunes = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestSubParse(t *testing.T) {
+	list := SepBy(Capture(Many1(Set("a-z"))), Lit(","))
+	g := SubParse(QuotedString(), list)
+	m, err := Parse(g, `"red,green,blue" rest`)
+	if err != nil || !reflect.DeepEqual(m, []interface{}{"red", "green", "blue"}) {
+		t.Errorf("SubParse = %#v, %v", m, err)
+	}
+	// Escapes are decoded before the inner grammar sees the text.
+	if m, err := Parse(SubParse(QuotedString(), Lit("a\"b")), `"a\"b"`); err != nil || m != "a\"b" {
+		t.Errorf("SubParse over escapes = %#v, %v", m, err)
+	}
+	sr := NewStringReader(`"red,Green"`)
+	_, err = g(sr)
+	if err == nil || err.Error() != "Expected end of inner input at offset 3" || sr.Pos() != 0 {
+		t.Errorf("SubParse with leftover text = %v at %d", err, sr.Pos())
+	}
+
+	// The inner reader shares the outer one's captures and step budget.
+	tag := And(Named("tag", Capture(Many1(Set("a-z")))), Lit("="))
+	g = And(tag, SubParse(QuotedString(), And(Lit("<"), BackReference("tag"), Lit(">"))))
+	if _, err := Parse(g, `b="<b>"`); err != nil {
+		t.Errorf("SubParse with a back-reference: %v", err)
+	}
+	sr = NewStringReader(`"red,green,blue"`, MaxSteps(25))
+	if _, err := SubParse(QuotedString(), list)(sr); err == nil || !strings.Contains(err.Error(), "Step limit") {
+		t.Errorf("SubParse escaped the step budget: %v", err)
+	}
+	sr = NewStringReader(`"red,green,blue"`, MaxSteps(25))
+	if _, err := QuotedString()(sr); err != nil {
+		t.Errorf("outer match alone exceeded the budget: %v", err)
+	}
+}
+
+func TestBoth(t *testing.T) {
+	keyword := Lit("int")
+	ident := Capture(Many1(Set("a-z")))
+	sr := NewStringReader("ab integer")
+	if _, err := Lit("ab ")(sr); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Both(keyword, ident)(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm := m.(BothMatch)
+	if bm.First.Match != "int" || bm.First.Span != (Span{3, 6}) || bm.First.Err != nil {
+		t.Errorf("First = %#v", bm.First)
+	}
+	if bm.Second.Match != "integer" || bm.Second.Span != (Span{3, 10}) || bm.Second.Err != nil {
+		t.Errorf("Second = %#v", bm.Second)
+	}
+	if sr.Pos() != 3 {
+		t.Errorf("Both consumed input up to %d", sr.Pos())
+	}
+
+	m, err = Parse(Both(keyword, ident), "float")
+	if bm, ok := m.(BothMatch); err != nil || !ok || bm.First.Err == nil || bm.Second.Match != "float" {
+		t.Errorf("Both with one failure = %#v, %v", m, err)
+	}
+	if _, err := Parse(Both(keyword, ident), "42"); err == nil {
+		t.Error("Both succeeded with neither grammar matching")
+	}
+}
+
+func TestRepeated(t *testing.T) {
+	group := And(LitIgnore("("), Capture(Many1(Set("a-z"))), LitIgnore(")"))
+	g := Repeated(Int(), group)
+	sr := NewStringReader("3(ab)(cd)(ef)(gh)")
+	m, err := g(sr)
+	if err != nil || String(m) != "abcdef" || len(m.([]interface{})) != 3 || sr.Pos() != 13 {
+		t.Errorf("Repeated = %#v, %v up to %d", m, err, sr.Pos())
+	}
+	if m, err := Parse(g, "0(ab)"); err != nil || len(m.([]interface{})) != 0 {
+		t.Errorf("Repeated zero times = %#v, %v", m, err)
+	}
+	sr = NewStringReader("3(ab)(cd)")
+	_, err = g(sr)
+	if err == nil || !strings.Contains(err.Error(), "Expected 3 repetitions, got 2") || sr.Pos() != 0 {
+		t.Errorf("Repeated short = %v at %d", err, sr.Pos())
+	}
+	if _, err := Parse(g, "-1(ab)"); err == nil {
+		t.Error("Repeated accepted a negative count")
+	}
+}
+
+type ifNode struct{ body []string }
+type whileNode struct{ body []string }
+
+func TestDispatch(t *testing.T) {
+	g := Dispatch(map[string]func() interface{}{
+		"if":    func() interface{} { return &ifNode{} },
+		"while": func() interface{} { return &whileNode{} },
+		"whil":  func() interface{} { return "prefix" },
+	})
+	m, err := Parse(g, "if x")
+	if _, ok := m.(*ifNode); err != nil || !ok {
+		t.Errorf("Dispatch on if = %#v, %v", m, err)
+	}
+	m, err = Parse(g, "while x")
+	if _, ok := m.(*whileNode); err != nil || !ok {
+		t.Errorf("Dispatch on while = %#v, %v", m, err)
+	}
+	// Each match builds a fresh node.
+	a, _ := Parse(g, "if")
+	b, _ := Parse(g, "if")
+	if a.(*ifNode) == b.(*ifNode) {
+		t.Error("Dispatch shared a node between matches")
+	}
+	sr := NewStringReader("for x")
+	if _, err := g(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("Dispatch on for = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestNonEmpty(t *testing.T) {
+	g := NonEmpty(Optional(Lit("a")))
+	sr := NewStringReader("ab")
+	if m, err := g(sr); err != nil || sr.Pos() != 1 {
+		t.Errorf("NonEmpty on a match = %v, %v at %d", m, err, sr.Pos())
+	}
+	// Optional succeeds on the b without consuming it.
+	if m, err := g(sr); err == nil || sr.Pos() != 1 {
+		t.Errorf("NonEmpty on a zero-width match = %v, %v at %d, want failure at 1", m, err, sr.Pos())
+	}
+	// Wrapped in a loop, the zero-width match ends it rather than passing.
+	sr = NewStringReader("aab")
+	m, err := Many(NonEmpty(Optional(Lit("a"))))(sr)
+	if err != nil || len(m.([]interface{})) != 2 || sr.Pos() != 2 {
+		t.Errorf("Many(NonEmpty) = %v, %v at %d", m, err, sr.Pos())
+	}
+}
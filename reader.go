@@ -0,0 +1,453 @@
+package stateparser
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"unicode/utf8"
+)
+
+// Positioner is implemented by readers that can report their current
+// position as a byte offset into the input.
+type Positioner interface {
+	Pos() int
+}
+
+// UserDataStore is implemented by readers that carry a user-defined value
+// through a parse, for context such as indentation stacks, mode flags or
+// symbol tables. The value is part of the reader's state, so backtracking
+// restores whatever value was current at the restored state. Only the value
+// itself is restored: treat it as immutable and set a new value rather than
+// modifying the old one in place, or changes made by failed alternatives
+// will leak.
+type UserDataStore interface {
+	UserData() interface{}
+	SetUserData(interface{})
+}
+
+func userDataStore(sr StateReader) (UserDataStore, bool) {
+	for {
+		if uds, ok := sr.(UserDataStore); ok {
+			return uds, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+// GetUserData returns the user data of sr, or nil if it has none or doesn't
+// implement UserDataStore.
+func GetUserData(sr StateReader) interface{} {
+	if uds, ok := userDataStore(sr); ok {
+		return uds.UserData()
+	}
+	return nil
+}
+
+// SetUserData sets the user data of sr, reporting false if sr doesn't
+// implement UserDataStore.
+func SetUserData(sr StateReader, data interface{}) bool {
+	uds, ok := userDataStore(sr)
+	if ok {
+		uds.SetUserData(data)
+	}
+	return ok
+}
+
+// Span is the range of input, as byte offsets, that a match came from. Both
+// offsets are -1 if the reader doesn't track positions.
+type Span struct {
+	Start, End int
+}
+
+// Lookbehind is implemented by readers that can report the rune before the
+// current position. ok is false at the start of input.
+type Lookbehind interface {
+	PrevRune() (r rune, ok bool)
+}
+
+// Peeker is implemented by readers that can look at upcoming runes without
+// consuming them. PeekRunes returns up to n runes, and io.EOF if the input
+// ends before n runes.
+type Peeker interface {
+	PeekRunes(n int) ([]rune, error)
+}
+
+func peeker(sr StateReader) (Peeker, bool) {
+	for {
+		if p, ok := sr.(Peeker); ok {
+			return p, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+// peekRune returns the next rune without consuming it, using PeekRunes if
+// the reader supports it.
+func peekRune(sr StateReader) (rune, error) {
+	if p, ok := peeker(sr); ok {
+		rs, err := p.PeekRunes(1)
+		if len(rs) == 0 {
+			return 0, err
+		}
+		return rs[0], nil
+	}
+	state := sr.State()
+	r, _, err := sr.ReadRune()
+	sr.RestoreState(state)
+	return r, err
+}
+
+// Forker is implemented by readers that can be forked into an independent
+// reader at the same position, so alternatives can be explored separately.
+// Not all readers support forking.
+type Forker interface {
+	Fork() StateReader
+}
+
+// wrapper is implemented by the readers combinators layer over the reader
+// they're given, so optional interfaces can still be found underneath.
+type wrapper interface {
+	unwrap() StateReader
+}
+
+func positioner(sr StateReader) (Positioner, bool) {
+	for {
+		if p, ok := sr.(Positioner); ok {
+			return p, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+// pos returns the reader's position, or -1 if it doesn't track one.
+func pos(sr StateReader) int {
+	if p, ok := positioner(sr); ok {
+		return p.Pos()
+	}
+	return -1
+}
+
+// StringReader is a StateReader over an in-memory string.
+type StringReader struct {
+	src      string
+	pos      int
+	furthest int
+	// expected holds the labels that failed at expectedPos, the furthest
+	// position any label failed at.
+	expected    []string
+	expectedPos int
+	captures    *namedCapture
+	userData    interface{}
+	comments    *commentList
+	steps       int
+	maxSteps    int
+	maxRunes    int
+	// sizeErr is set if the input exceeds maxRunes.
+	sizeErr error
+	hash    hash.Hash
+	hashed  int
+}
+
+type readerState struct {
+	pos      int
+	captures *namedCapture
+	userData interface{}
+	comments *commentList
+}
+
+// An Option configures a StringReader.
+type Option func(*StringReader)
+
+// MaxSteps limits the number of runes a parse may read, counting runes read
+// again after backtracking, as a guard against catastrophic backtracking on
+// untrusted input. Once the budget is spent ReadRune fails with a fatal error,
+// aborting the parse.
+func MaxSteps(n int) Option {
+	return func(sr *StringReader) {
+		sr.maxSteps = n
+	}
+}
+
+// MaxInputRunes rejects input longer than n runes. Parse and ParseDiag fail
+// before running the grammar at all; a StringReader used directly fails its
+// first ReadRune with a fatal error, aborting the parse. Unlike MaxSteps it
+// bounds the input itself rather than the work done on it.
+func MaxInputRunes(n int) Option {
+	return func(sr *StringReader) {
+		sr.maxRunes = n
+	}
+}
+
+// checkSize reports an error if the input exceeds the MaxInputRunes limit.
+func (sr *StringReader) checkSize() error {
+	return sr.sizeErr
+}
+
+func NewStringReader(s string, opts ...Option) *StringReader {
+	sr := &StringReader{src: s}
+	for _, opt := range opts {
+		opt(sr)
+	}
+	if sr.maxRunes > 0 && utf8.RuneCountInString(s) > sr.maxRunes {
+		sr.sizeErr = fmt.Errorf("Input too large: more than %d runes", sr.maxRunes)
+	}
+	return sr
+}
+
+func (sr *StringReader) ReadRune() (rune, int, error) {
+	if sr.sizeErr != nil {
+		return 0, 0, fatalError{sr.sizeErr}
+	}
+	if sr.maxSteps > 0 {
+		if sr.steps >= sr.maxSteps {
+			return 0, 0, fatalError{fmt.Errorf("Step limit of %d exceeded", sr.maxSteps)}
+		}
+		sr.steps++
+	}
+	if sr.pos > sr.furthest {
+		sr.furthest = sr.pos
+	}
+	if sr.pos >= len(sr.src) {
+		return 0, 0, io.EOF
+	}
+	r, size := utf8.DecodeRuneInString(sr.src[sr.pos:])
+	sr.pos += size
+	return r, size, nil
+}
+
+func (sr *StringReader) State() interface{} {
+	return readerState{pos: sr.pos, captures: sr.captures, userData: sr.userData, comments: sr.comments}
+}
+
+func (sr *StringReader) RestoreState(state interface{}) {
+	rs := state.(readerState)
+	sr.pos = rs.pos
+	sr.captures = rs.captures
+	sr.userData = rs.userData
+	sr.comments = rs.comments
+}
+
+func (sr *StringReader) Pos() int {
+	return sr.pos
+}
+
+func (sr *StringReader) StoreCapture(name, value string) {
+	sr.captures = &namedCapture{name, value, sr.captures}
+}
+
+func (sr *StringReader) GetCapture(name string) (string, bool) {
+	return sr.captures.get(name)
+}
+
+func (sr *StringReader) UserData() interface{} {
+	return sr.userData
+}
+
+func (sr *StringReader) SetUserData(data interface{}) {
+	sr.userData = data
+}
+
+func (sr *StringReader) AddComment(c Comment) {
+	sr.comments = &commentList{c, sr.comments}
+}
+
+// Comments returns the comments collected so far, in input order.
+func (sr *StringReader) Comments() []Comment {
+	return sr.comments.slice()
+}
+
+func (sr *StringReader) PeekRunes(n int) ([]rune, error) {
+	rs := make([]rune, 0, n)
+	for p := sr.pos; len(rs) < n; {
+		if p >= len(sr.src) {
+			return rs, io.EOF
+		}
+		r, size := utf8.DecodeRuneInString(sr.src[p:])
+		rs = append(rs, r)
+		p += size
+	}
+	return rs, nil
+}
+
+func (sr *StringReader) PrevRune() (rune, bool) {
+	if sr.pos == 0 {
+		return 0, false
+	}
+	r, _ := utf8.DecodeLastRuneInString(sr.src[:sr.pos])
+	return r, true
+}
+
+func (sr *StringReader) expect(name string, pos int) {
+	if pos < sr.expectedPos {
+		return
+	}
+	if pos > sr.expectedPos {
+		sr.expected, sr.expectedPos = nil, pos
+	}
+	for _, e := range sr.expected {
+		if e == name {
+			return
+		}
+	}
+	sr.expected = append(sr.expected, name)
+}
+
+// Furthest returns the furthest offset any read has been attempted at,
+// including by alternatives that were later backtracked.
+func (sr *StringReader) Furthest() int {
+	return sr.furthest
+}
+
+// furthestTracker is implemented by readers that track the furthest
+// position reached for error reporting, so that speculative read-ahead can
+// be kept out of it.
+type furthestTracker interface {
+	furthestState() interface{}
+	restoreFurthest(state interface{}, p int)
+	swapFurthest(p int) int
+}
+
+func tracker(sr StateReader) (furthestTracker, bool) {
+	for {
+		if ft, ok := sr.(furthestTracker); ok {
+			return ft, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+type furthestState struct {
+	furthest, expectedPos int
+	expected              []string
+}
+
+func (sr *StringReader) furthestState() interface{} {
+	return furthestState{sr.furthest, sr.expectedPos, sr.expected}
+}
+
+func (sr *StringReader) restoreFurthest(state interface{}, p int) {
+	fs := state.(furthestState)
+	sr.furthest, sr.expectedPos, sr.expected = fs.furthest, fs.expectedPos, fs.expected
+	if p > sr.furthest {
+		sr.furthest = p
+	}
+}
+
+// swapFurthest sets the furthest position to p, returning the old one.
+func (sr *StringReader) swapFurthest(p int) int {
+	old := sr.furthest
+	sr.furthest = p
+	return old
+}
+
+// speculate marks the start of read-ahead, such as scanning for the longest
+// prefix a parser accepts. Calling the returned function forgets how far the
+// read-ahead went for error reporting, keeping only the reader's position at
+// that point, so Furthest still points at the real error.
+func speculate(sr StateReader) func() {
+	ft, ok := tracker(sr)
+	if !ok {
+		return func() {}
+	}
+	saved := ft.furthestState()
+	return func() {
+		ft.restoreFurthest(saved, pos(sr))
+	}
+}
+
+// Fork returns a new StringReader at the same position, sharing the input
+// but otherwise independent of sr. A hash set by HashConsumed is not carried
+// over, since both readers would write into it; the fork reports no
+// ConsumedHash.
+func (sr *StringReader) Fork() StateReader {
+	f := *sr
+	f.expected = append([]string(nil), sr.expected...)
+	f.hash, f.hashed = nil, 0
+	return &f
+}
+
+// sharedContext is the part of a reader's state that SubParse hands on to
+// the reader it runs the inner grammar over, and takes back afterwards.
+type sharedContext struct {
+	captures *namedCapture
+	userData interface{}
+	comments *commentList
+	// steps and maxSteps carry the MaxSteps budget; readers without one
+	// leave maxSteps at 0.
+	steps, maxSteps int
+}
+
+// contextSharer is implemented by readers that can hand their context to a
+// reader over other input.
+type contextSharer interface {
+	sharedContext() sharedContext
+	setSharedContext(sharedContext)
+}
+
+func sharer(sr StateReader) (contextSharer, bool) {
+	for {
+		if cs, ok := sr.(contextSharer); ok {
+			return cs, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+func (sr *StringReader) sharedContext() sharedContext {
+	return sharedContext{sr.captures, sr.userData, sr.comments, sr.steps, sr.maxSteps}
+}
+
+func (sr *StringReader) setSharedContext(c sharedContext) {
+	sr.captures, sr.userData, sr.comments = c.captures, c.userData, c.comments
+	sr.steps, sr.maxSteps = c.steps, c.maxSteps
+}
+
+// ParseError is returned by Parse when the grammar fails. Pos is the
+// furthest offset the parse reached, which is usually closer to the real
+// mistake than wherever the last alternative happened to give up.
+type ParseError struct {
+	Pos int
+	Err error
+}
+
+func (pe ParseError) Error() string {
+	return fmt.Sprintf("Parse error at offset %d: %s", pe.Pos, pe.Err)
+}
+
+func (pe ParseError) Unwrap() error {
+	return pe.Err
+}
+
+// Parse runs g over input. It does not require g to consume all of input.
+// On failure the error is a ParseError.
+func Parse(g Grammar, input string, opts ...Option) (interface{}, error) {
+	sr := NewStringReader(input, opts...)
+	if err := sr.checkSize(); err != nil {
+		return nil, ParseError{Pos: 0, Err: err}
+	}
+	m, err := g(sr)
+	if err != nil {
+		return nil, ParseError{Pos: sr.Furthest(), Err: err}
+	}
+	return m, nil
+}
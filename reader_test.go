@@ -0,0 +1,200 @@
+package stateparser
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMaxSteps(t *testing.T) {
+	// Each alternative rereads the whole run of a's before failing on the
+	// final rune, so the work grows quadratically with the input.
+	a := Many(Lit("a"))
+	var alts []Grammar
+	for i := 0; i < 50; i++ {
+		alts = append(alts, And(a, Lit("b")))
+	}
+	g := Or(alts...)
+	input := strings.Repeat("a", 1000) + "c"
+
+	_, err := Parse(g, input, MaxSteps(10000))
+	if err == nil || !strings.Contains(err.Error(), "Step limit of 10000 exceeded") {
+		t.Fatalf("Parse = %v, want step limit error", err)
+	}
+	if _, err := Parse(Many(Lit("a")), "aaa", MaxSteps(10)); err != nil {
+		t.Fatalf("Parse within budget = %v", err)
+	}
+}
+
+func TestMaxStepsNotSwallowed(t *testing.T) {
+	input := strings.Repeat("a", 12)
+	tests := []struct {
+		name  string
+		g     Grammar
+		input string
+	}{
+		{"CountRunes", CountRunes('a'), ""},
+		{"Repeat", Repeat(0, 0, func(r rune) bool { return r == 'a' }), ""},
+		{"Many(Repeat)", Many(Repeat(1, 2, func(r rune) bool { return r == 'a' })), ""},
+		{"LongestPrefix", LongestPrefix(input + "b"), ""},
+		{"UpTo", UpTo("ab"), ""},
+		{"Quoted", Quoted('a', 'b', '\\'), ""},
+		{"RawString", RawString('"'), `"` + input},
+		{"Unescape", Unescape(EscapeTable{}, Lit("b")), ""},
+		{"PercentDecoded", PercentDecoded(func(r rune) bool { return r == 'b' }), ""},
+		{"DateTime", DateTime("2006"), ""},
+		{"Regexp", Regexp(`a*`), ""},
+		{"Fenced", Fenced("a"), ""},
+		{"Trimmed", Trimmed(Lit("b")), strings.Repeat(" ", 12)},
+		{"AtEnd", AtEnd(Lit("aaa")), input},
+	}
+	for _, tt := range tests {
+		in := tt.input
+		if in == "" {
+			in = input
+		}
+		m, err := Parse(tt.g, in, MaxSteps(3))
+		if err == nil || !strings.Contains(err.Error(), "Step limit") {
+			t.Errorf("%s: Parse = %v, %v, want step limit error", tt.name, m, err)
+		}
+	}
+}
+
+func TestParseErrorAtFurthest(t *testing.T) {
+	g := Or(And(Lit("let"), Lit(" "), Lit("x"), Lit("=")), Lit("print"))
+	_, err := Parse(g, "let x+1")
+	pe, ok := err.(ParseError)
+	if !ok {
+		t.Fatalf("Parse = %v, want ParseError", err)
+	}
+	// The last alternative tried fails at offset 0, but the first got as
+	// far as the '+'.
+	if pe.Pos != 5 {
+		t.Errorf("Pos = %d, want 5", pe.Pos)
+	}
+}
+
+func TestFurthestIgnoresReadAhead(t *testing.T) {
+	tests := []struct {
+		name  string
+		g     Grammar
+		input string
+		pos   int
+	}{
+		{"DateTime", And(DateTime("2006-01-02"), Lit("X")), "2006-01-02Y and more text here", 10},
+		{"IPAddress", And(IPAddress(), Lit("X")), "10.0.0.1:8080", 8},
+		{"Regexp", And(Regexp(`a+`), Lit("X")), "aaab", 3},
+		{"Tuple", And(Tuple(Lit("("), Lit(")"), Lit(","), Lit("a")), Lit("X")), "(a)Y, and then some", 3},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.g, tt.input)
+		pe, ok := err.(ParseError)
+		if !ok || pe.Pos != tt.pos {
+			t.Errorf("%s: Parse = %v, want error at offset %d", tt.name, err, tt.pos)
+		}
+	}
+}
+
+func TestFork(t *testing.T) {
+	sr := NewStringReader("abcdef")
+	if _, err := Lit("ab")(sr); err != nil {
+		t.Fatal(err)
+	}
+	var fr StateReader = sr.Fork()
+	if m, err := Lit("cd")(fr); err != nil || m != "cd" {
+		t.Fatalf("fork = %v, %v", m, err)
+	}
+	if sr.Pos() != 2 {
+		t.Errorf("advancing the fork moved the original to %d", sr.Pos())
+	}
+	if m, err := Lit("c")(sr); err != nil || m != "c" || fr.(Positioner).Pos() != 4 {
+		t.Errorf("original = %v, %v, fork at %d, want fork at 4", m, err, fr.(Positioner).Pos())
+	}
+	state := fr.State()
+	Lit("ef")(fr)
+	fr.RestoreState(state)
+	if m, err := Lit("ef")(fr); err != nil || m != "ef" || sr.Pos() != 3 {
+		t.Errorf("fork after restore = %v, %v, original at %d", m, err, sr.Pos())
+	}
+}
+
+func TestUserData(t *testing.T) {
+	setMode := func(mode string) Grammar {
+		return func(sr StateReader) (interface{}, error) {
+			SetUserData(sr, mode)
+			return nil, nil
+		}
+	}
+	inMode := func(mode string) func(StateReader) bool {
+		return func(sr StateReader) bool { return GetUserData(sr) == mode }
+	}
+	word := Capture(Many1(Set("a-z")))
+	g := And(
+		Or(And(Lit("<"), setMode("tag")), setMode("text")),
+		Or(When(inMode("tag"), And(word, Lit(">"))), When(inMode("text"), word)),
+	)
+	for _, input := range []string{"<b>", "hello"} {
+		if _, err := Parse(g, input); err != nil {
+			t.Errorf("on %q: %v", input, err)
+		}
+	}
+	if _, err := Parse(g, "<b"); err == nil {
+		t.Error("text mode leaked into a tag")
+	}
+
+	// Backtracking restores the data current at the saved state.
+	sr := NewStringReader("ab")
+	SetUserData(sr, 1)
+	if _, err := And(setMode("x"), Lit("a"), Lit("c"))(sr); err == nil {
+		t.Fatal("And matched")
+	}
+	if d := GetUserData(sr); d != 1 {
+		t.Errorf("user data after backtracking = %v, want 1", d)
+	}
+	if SetUserData(&captureReader{StateReader: sr}, 2); GetUserData(sr) != 2 {
+		t.Error("SetUserData did not reach through a wrapping reader")
+	}
+}
+
+func TestPeekRunes(t *testing.T) {
+	readers := map[string]func() StateReader{
+		"StringReader": func() StateReader { return NewStringReader("abcdé") },
+		"StreamReader": func() StateReader { return NewStreamReader(strings.NewReader("abcdé")) },
+	}
+	for name, newReader := range readers {
+		sr := newReader()
+		p := sr.(Peeker)
+		if rs, err := p.PeekRunes(3); err != nil || string(rs) != "abc" {
+			t.Errorf("%s: PeekRunes(3) = %q, %v", name, string(rs), err)
+		}
+		if _, err := Lit("abc")(sr); err != nil {
+			t.Fatalf("%s: peeking consumed input: %v", name, err)
+		}
+		rs, err := p.PeekRunes(3)
+		if err != io.EOF || string(rs) != "dé" {
+			t.Errorf("%s: PeekRunes(3) near the end = %q, %v, want %q, EOF", name, string(rs), err, "dé")
+		}
+		if m, err := Lit("dé")(sr); err != nil || m != "dé" {
+			t.Errorf("%s: read after peek = %v, %v", name, m, err)
+		}
+	}
+}
+
+func TestMaxInputRunes(t *testing.T) {
+	g := Many(NotSet(""))
+	if _, err := Parse(g, "héllo", MaxInputRunes(5)); err != nil {
+		t.Errorf("input at the limit: %v", err)
+	}
+	_, err := Parse(g, "héllo!", MaxInputRunes(5))
+	if err == nil || !strings.Contains(err.Error(), "Input too large: more than 5 runes") {
+		t.Errorf("Parse = %v, want input too large", err)
+	}
+	if _, d := ParseDiag(g, "héllo!", MaxInputRunes(5)); d == nil || !strings.Contains(d.Err.Error(), "Input too large") {
+		t.Errorf("ParseDiag = %v, want input too large", d)
+	}
+	// The limit holds for a reader used directly as well.
+	sr := NewStringReader("héllo!", MaxInputRunes(5))
+	if _, err := Or(Lit("x"), g)(sr); err == nil || !strings.Contains(err.Error(), "Input too large") {
+		t.Errorf("grammar on an oversized reader = %v, want input too large", err)
+	}
+}
@@ -0,0 +1,66 @@
+package stateparser
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// runeReader adapts a StateReader for the regexp package, which treats any
+// read error as the end of input; a fatal error is kept so it can be
+// reported after the match.
+type runeReader struct {
+	sr  StateReader
+	err error
+}
+
+func (rr *runeReader) ReadRune() (rune, int, error) {
+	r, size, err := rr.sr.ReadRune()
+	if _, isFE := err.(fatalError); isFE {
+		rr.err = err
+	}
+	return r, size, err
+}
+
+// Regexp matches pattern at the current position and returns the matched
+// text. It panics if pattern doesn't compile.
+func Regexp(pattern string) Grammar {
+	return matchRegexp(regexp.MustCompile(`^(?:`+pattern+`)`), pattern)
+}
+
+// RegexpCompiled is like Regexp but takes an already compiled regexp, which
+// is used as is, so flags and leftmost-longest matching set by the caller
+// apply. The regexp is run over the input from the current position and
+// only a match starting there is taken. An unanchored regexp may therefore
+// read ahead to a match further on, or to the end of input, before failing;
+// start it with ^, which anchors it to the current position, to avoid that.
+func RegexpCompiled(re *regexp.Regexp) Grammar {
+	return matchRegexp(re, re.String())
+}
+
+func matchRegexp(re *regexp.Regexp, pattern string) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		rr := &runeReader{sr: sr}
+		done := speculate(sr)
+		loc := re.FindReaderIndex(rr)
+		if rr.err != nil {
+			return nil, rr.err
+		}
+		sr.RestoreState(state)
+		done()
+		if loc == nil || loc[0] != 0 {
+			return nil, fmt.Errorf("Expected match of /%s/", pattern)
+		}
+		rs := []rune{}
+		for n := 0; n < loc[1]; {
+			r, size, err := sr.ReadRune()
+			if err != nil {
+				sr.RestoreState(state)
+				return nil, err
+			}
+			rs = append(rs, r)
+			n += size
+		}
+		return string(rs), nil
+	}
+}
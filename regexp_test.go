@@ -0,0 +1,53 @@
+package stateparser
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRegexpCompiledCaseInsensitive(t *testing.T) {
+	g := RegexpCompiled(regexp.MustCompile(`(?i)select`))
+	for _, in := range []string{"SELECT *", "select *", "SeLeCt *"} {
+		sr := NewStringReader(in)
+		m, err := g(sr)
+		if err != nil || m != in[:6] {
+			t.Errorf("%q: match = %v, %v", in, m, err)
+		}
+		if sr.Pos() != 6 {
+			t.Errorf("%q: Pos = %d, want 6", in, sr.Pos())
+		}
+	}
+	if _, err := Parse(g, "xSELECT"); err == nil {
+		t.Error("RegexpCompiled matched away from the current position")
+	}
+}
+
+func TestRegexpCompiledLongest(t *testing.T) {
+	re := regexp.MustCompilePOSIX(`a|ab`)
+	if m, err := Parse(RegexpCompiled(re), "ab"); err != nil || m != "ab" {
+		t.Errorf("POSIX regexp: match = %v, %v, want %q", m, err, "ab")
+	}
+	if m, err := Parse(RegexpCompiled(regexp.MustCompile(`a|ab`)), "ab"); err != nil || m != "a" {
+		t.Errorf("Perl regexp: match = %v, %v, want %q", m, err, "a")
+	}
+}
+
+func TestRegexpCompiledReusesRegexp(t *testing.T) {
+	// An unanchored regexp only matches at the current position, even when
+	// it would match further on.
+	g := RegexpCompiled(regexp.MustCompile(`[0-9]+`))
+	sr := NewStringReader("x12")
+	if m, err := g(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("match away from the current position = %v, %v at %d", m, err, sr.Pos())
+	}
+	sr = NewStringReader("12x")
+	if m, err := g(sr); err != nil || m != "12" || sr.Pos() != 2 {
+		t.Errorf("match = %v, %v at %d, want %q at 2", m, err, sr.Pos(), "12")
+	}
+	// Anchored, it matches at the current position rather than the start
+	// of input.
+	g = And(Lit("x"), RegexpCompiled(regexp.MustCompile(`^[0-9]+`)))
+	if _, err := Parse(g, "x12"); err != nil {
+		t.Errorf("anchored match after a prefix: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package stateparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as matched by SemVer.
+type Version struct {
+	Major, Minor, Patch uint64
+	Pre                 []string
+	Build               []string
+}
+
+var (
+	semverIdent  = Capture(Many1(Set("0-9A-Za-z-")))
+	semverIdents = Capture(And(semverIdent, Many(And(Lit("."), semverIdent))))
+	semverToken  = AndStruct(
+		Capture(Many1(Set("0-9"))), Lit("."),
+		Capture(Many1(Set("0-9"))), Lit("."),
+		Capture(Many1(Set("0-9"))),
+		Optional(And(Ignore(Lit("-")), semverIdents)),
+		Optional(And(Ignore(Lit("+")), semverIdents)),
+	)
+)
+
+// isNumericIdent reports whether s is all digits, and so subject to the
+// no leading zeros rule.
+func isNumericIdent(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// SemVer matches a semantic version, MAJOR.MINOR.PATCH with optional
+// pre-release and build metadata as in "1.0.0-alpha.1+build.5", and returns
+// it as a Version. Numeric components with leading zeros are rejected, as
+// the specification requires.
+func SemVer() Grammar {
+	return Label("semantic version", func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := semverToken(sr)
+		if err != nil {
+			return nil, err
+		}
+		ms := m.([]interface{})
+		v := Version{}
+		for i, part := range []*uint64{&v.Major, &v.Minor, &v.Patch} {
+			s := ms[2*i].(string)
+			if len(s) > 1 && s[0] == '0' {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Leading zero in version number %q", s)
+			}
+			if *part, err = strconv.ParseUint(s, 10, 64); err != nil {
+				sr.RestoreState(state)
+				return nil, err
+			}
+		}
+		if pre := ms[5].([]interface{}); len(pre) > 0 {
+			v.Pre = strings.Split(String(pre), ".")
+			for _, id := range v.Pre {
+				if len(id) > 1 && id[0] == '0' && isNumericIdent(id) {
+					sr.RestoreState(state)
+					return nil, fmt.Errorf("Leading zero in pre-release identifier %q", id)
+				}
+			}
+		}
+		if build := ms[6].([]interface{}); len(build) > 0 {
+			v.Build = strings.Split(String(build), ".")
+		}
+		return v, nil
+	})
+}
@@ -0,0 +1,30 @@
+package stateparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemVer(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Version
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"1.0.0-alpha.1+build", Version{Major: 1, Pre: []string{"alpha", "1"}, Build: []string{"build"}}},
+		{"0.10.0+001.sha-5114f85", Version{Minor: 10, Build: []string{"001", "sha-5114f85"}}},
+		{"2.0.0-rc.0", Version{Major: 2, Pre: []string{"rc", "0"}}},
+	}
+	for _, tt := range tests {
+		m, err := Parse(SemVer(), tt.input)
+		if err != nil || !reflect.DeepEqual(m, tt.want) {
+			t.Errorf("SemVer on %q = %#v, %v, want %#v", tt.input, m, err, tt.want)
+		}
+	}
+	for _, input := range []string{"01.2.3", "1.02.3", "1.2.03", "1.0.0-01", "1.2", "v1.2.3", "1.2.3-"} {
+		sr := NewStringReader(input)
+		if m, err := AtEnd(SemVer())(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("SemVer on %q = %#v, %v at %d, want failure at 0", input, m, err, sr.Pos())
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Package sexpr is a small example of a recursive grammar built with
+// stateparser, parsing Lisp-style s-expressions.
+package sexpr
+
+import (
+	"strconv"
+
+	sp "github.com/andyleap/stateparser"
+)
+
+// Symbol is a bare atom such as + or define, kept distinct from string
+// literals.
+type Symbol string
+
+// SExpr returns a grammar matching a single s-expression, with optional
+// surrounding whitespace. Lists become []interface{}, quoted strings
+// string, integers int64, other numbers float64, and any other atom a
+// Symbol.
+func SExpr() sp.Grammar {
+	var expr sp.Grammar
+
+	ws := sp.Ignore(sp.Whitespace0())
+
+	// Only decimal numerals are numbers, so symbols such as nan and inf,
+	// which strconv.ParseFloat would also accept, stay symbols.
+	float := sp.AtEnd(sp.Float())
+
+	atom := sp.Node(sp.Mult(1, 0, sp.NotSet("()\" \t\r\n")), func(m interface{}) (interface{}, error) {
+		s := sp.String(m)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := sp.Parse(float, s); err == nil {
+			return f, nil
+		}
+		return Symbol(s), nil
+	})
+
+	list := sp.Pick(1,
+		sp.Lit("("),
+		sp.Many(sp.Pick(1, ws, sp.Resolve(&expr))),
+		ws, sp.Lit(")"),
+	)
+
+	expr = sp.Or(list, sp.QuotedString(), atom)
+
+	return sp.Pick(1, ws, sp.Resolve(&expr), ws)
+}
@@ -0,0 +1,40 @@
+package sexpr
+
+import (
+	"reflect"
+	"testing"
+
+	sp "github.com/andyleap/stateparser"
+)
+
+func TestSExpr(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"(+ 1 (* 2 3))", []interface{}{Symbol("+"), int64(1), []interface{}{Symbol("*"), int64(2), int64(3)}}},
+		{` ( concat "a b" "(" ) `, []interface{}{Symbol("concat"), "a b", "("}},
+		{"(define nan inf)", []interface{}{Symbol("define"), Symbol("nan"), Symbol("inf")}},
+		{"(1.5 -2 1e3 infinity)", []interface{}{1.5, int64(-2), 1e3, Symbol("infinity")}},
+		{"(() (()))", []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}}},
+		{"atom", Symbol("atom")},
+	}
+	for _, tt := range tests {
+		got, err := sp.Parse(sp.AtEnd(SExpr()), tt.input)
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSExprRejects(t *testing.T) {
+	for _, input := range []string{"(+ 1", "(a))", ")", `("unterminated)`} {
+		if got, err := sp.Parse(sp.AtEnd(SExpr()), input); err == nil {
+			t.Errorf("%q = %#v, want error", input, got)
+		}
+	}
+}
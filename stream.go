@@ -0,0 +1,213 @@
+package stateparser
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// Releaser is implemented by readers that buffer their input and can be
+// told that nothing before the current position will be read again.
+type Releaser interface {
+	Release()
+}
+
+type bufferedRune struct {
+	r    rune
+	size int
+}
+
+// StreamReader is a StateReader over an io.RuneReader. Runes are buffered
+// from the oldest state that might still be restored, which without
+// NoBacktrack is the start of the input; NoBacktrack lets it release the
+// buffer behind a committed region.
+type StreamReader struct {
+	src      io.RuneReader
+	buf      []bufferedRune
+	base     int
+	pos      int
+	bytePos  int
+	captures *namedCapture
+	userData interface{}
+	comments *commentList
+	lost     bool
+}
+
+var errReleased = errors.New("Backtracked into input released by NoBacktrack")
+
+type streamState struct {
+	pos, bytePos int
+	captures     *namedCapture
+	userData     interface{}
+	comments     *commentList
+}
+
+func NewStreamReader(src io.RuneReader) *StreamReader {
+	return &StreamReader{src: src}
+}
+
+func (sr *StreamReader) ReadRune() (rune, int, error) {
+	if sr.lost {
+		return 0, 0, fatalError{errReleased}
+	}
+	i := sr.pos - sr.base
+	if i == len(sr.buf) {
+		r, size, err := sr.src.ReadRune()
+		if err != nil {
+			return 0, 0, err
+		}
+		if size == 0 {
+			size = utf8.RuneLen(r)
+		}
+		sr.buf = append(sr.buf, bufferedRune{r, size})
+	}
+	br := sr.buf[i]
+	sr.pos++
+	sr.bytePos += br.size
+	return br.r, br.size, nil
+}
+
+func (sr *StreamReader) State() interface{} {
+	return streamState{sr.pos, sr.bytePos, sr.captures, sr.userData, sr.comments}
+}
+
+// RestoreState cannot go back to a state before input that has been
+// released. Instead the reader is marked as lost, and every later read
+// fails with a fatal error, aborting the parse.
+func (sr *StreamReader) RestoreState(state interface{}) {
+	ss := state.(streamState)
+	if ss.pos < sr.base {
+		sr.lost = true
+		return
+	}
+	sr.pos, sr.bytePos, sr.captures = ss.pos, ss.bytePos, ss.captures
+	sr.userData = ss.userData
+	sr.comments = ss.comments
+}
+
+func (sr *StreamReader) UserData() interface{} {
+	return sr.userData
+}
+
+func (sr *StreamReader) SetUserData(data interface{}) {
+	sr.userData = data
+}
+
+func (sr *StreamReader) StoreCapture(name, value string) {
+	sr.captures = &namedCapture{name, value, sr.captures}
+}
+
+func (sr *StreamReader) GetCapture(name string) (string, bool) {
+	return sr.captures.get(name)
+}
+
+func (sr *StreamReader) sharedContext() sharedContext {
+	return sharedContext{captures: sr.captures, userData: sr.userData, comments: sr.comments}
+}
+
+func (sr *StreamReader) setSharedContext(c sharedContext) {
+	sr.captures, sr.userData, sr.comments = c.captures, c.userData, c.comments
+}
+
+func (sr *StreamReader) Pos() int {
+	return sr.bytePos
+}
+
+func (sr *StreamReader) AddComment(c Comment) {
+	sr.comments = &commentList{c, sr.comments}
+}
+
+// Comments returns the comments collected so far, in input order.
+func (sr *StreamReader) Comments() []Comment {
+	return sr.comments.slice()
+}
+
+func (sr *StreamReader) PeekRunes(n int) ([]rune, error) {
+	state := sr.State()
+	defer sr.RestoreState(state)
+	rs := make([]rune, 0, n)
+	for len(rs) < n {
+		r, _, err := sr.ReadRune()
+		if err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// PrevRune reports the rune before the current position, which is only
+// known if it hasn't been released.
+func (sr *StreamReader) PrevRune() (rune, bool) {
+	if sr.pos == sr.base {
+		return 0, false
+	}
+	return sr.buf[sr.pos-sr.base-1].r, true
+}
+
+// Buffered returns the number of runes currently held in the buffer.
+func (sr *StreamReader) Buffered() int {
+	return len(sr.buf)
+}
+
+// Release discards the buffered input before the current position.
+func (sr *StreamReader) Release() {
+	n := copy(sr.buf, sr.buf[sr.pos-sr.base:])
+	sr.buf = sr.buf[:n]
+	sr.base = sr.pos
+}
+
+func releaser(sr StateReader) (Releaser, bool) {
+	for {
+		if r, ok := sr.(Releaser); ok {
+			return r, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+// progressReader records whether any rune was read through it.
+type progressReader struct {
+	StateReader
+	read bool
+}
+
+func (pr *progressReader) unwrap() StateReader {
+	return pr.StateReader
+}
+
+func (pr *progressReader) ReadRune() (rune, int, error) {
+	r, size, err := pr.StateReader.ReadRune()
+	if err == nil {
+		pr.read = true
+	}
+	return r, size, err
+}
+
+// NoBacktrack commits to g: once g has read a rune, its failure is made
+// fatal, as with Require, and once g matches the reader is told it may
+// release the input behind it. A failure before g reads anything, such as at
+// the end of input, is an ordinary failure, so NoBacktrack can be repeated.
+// This bounds the memory a StreamReader needs, but means no enclosing
+// grammar may backtrack to before the end of g; if one tries, the parse is
+// aborted with a fatal error.
+func NoBacktrack(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		pr := &progressReader{StateReader: sr}
+		m, err := g(pr)
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE || !pr.read {
+				return nil, err
+			}
+			return nil, fatalError{err}
+		}
+		if r, ok := releaser(sr); ok {
+			r.Release()
+		}
+		return m, nil
+	}
+}
@@ -0,0 +1,57 @@
+package stateparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNoBacktrackReleasesBuffer(t *testing.T) {
+	sr := NewStreamReader(strings.NewReader("header;body"))
+	m, err := NoBacktrack(And(Lit("header"), Lit(";")))(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := String(m); got != "header;" {
+		t.Errorf("match = %q, want %q", got, "header;")
+	}
+	if n := sr.Buffered(); n != 0 {
+		t.Errorf("Buffered() after committed region = %d, want 0", n)
+	}
+	if m, err := Lit("body")(sr); err != nil || m != "body" {
+		t.Errorf("Lit after NoBacktrack = %v, %v", m, err)
+	}
+	if n := sr.Buffered(); n != 4 {
+		t.Errorf("Buffered() = %d, want 4", n)
+	}
+}
+
+func TestNoBacktrackRepeated(t *testing.T) {
+	sr := NewStreamReader(strings.NewReader("ababab"))
+	m, err := Many(NoBacktrack(Lit("ab")))(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := String(m); got != "ababab" {
+		t.Errorf("match = %q, want %q", got, "ababab")
+	}
+	if n := sr.Buffered(); n != 0 {
+		t.Errorf("Buffered() = %d, want 0", n)
+	}
+}
+
+func TestNoBacktrackCommits(t *testing.T) {
+	sr := NewStreamReader(strings.NewReader("ac"))
+	_, err := Or(NoBacktrack(Lit("ab")), Lit("ac"))(sr)
+	if err == nil || !strings.Contains(err.Error(), "Fatal") {
+		t.Errorf("failure after reading = %v, want fatal error", err)
+	}
+}
+
+func TestRestoreIntoReleasedInput(t *testing.T) {
+	sr := NewStreamReader(strings.NewReader("abX"))
+	g := Or(And(NoBacktrack(Lit("ab")), Lit("c")), Lit("abX"))
+	_, err := g(sr)
+	if err == nil || !strings.Contains(err.Error(), "released") {
+		t.Errorf("backtracking into released input = %v, want fatal error", err)
+	}
+}
@@ -0,0 +1,668 @@
+package stateparser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+var space = satisfy("whitespace", unicode.IsSpace)
+
+// Whitespace1 matches one or more whitespace runes and returns them as a
+// string, for grammars that need to preserve layout.
+func Whitespace1() Grammar {
+	return Capture(Mult(1, 0, space))
+}
+
+// Whitespace0 is like Whitespace1 but also matches no whitespace at all,
+// returning "".
+func Whitespace0() Grammar {
+	return Capture(Mult(0, 0, space))
+}
+
+// Rest consumes everything up to the end of input and returns it as a
+// string, which is "" if already at the end.
+func Rest() Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		rs := []rune{}
+		for {
+			state := sr.State()
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(state)
+				return string(rs), nil
+			}
+			rs = append(rs, r)
+		}
+	}
+}
+
+// UpTo matches and returns all text before the first occurrence of
+// sentinel, leaving the sentinel itself unconsumed. It fails if the input
+// ends before sentinel is found.
+func UpTo(sentinel string) Grammar {
+	if sentinel == "" {
+		panic("stateparser: UpTo with empty sentinel")
+	}
+	want := []rune(sentinel)
+	return func(sr StateReader) (interface{}, error) {
+		start := sr.State()
+		rs := []rune{}
+		for {
+			state := sr.State()
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(start)
+				return nil, fmt.Errorf("Expected %q before end of input", sentinel)
+			}
+			if r == want[0] {
+				after := sr.State()
+				found, err := lookingAt(sr, want[1:])
+				if err != nil {
+					return nil, err
+				}
+				if found {
+					sr.RestoreState(state)
+					return string(rs), nil
+				}
+				sr.RestoreState(after)
+			}
+			rs = append(rs, r)
+		}
+	}
+}
+
+// lookingAt reports whether the next runes in sr are want; the caller is
+// responsible for restoring state. A fatal read error is returned as is.
+func lookingAt(sr StateReader, want []rune) (bool, error) {
+	for _, w := range want {
+		r, _, err := sr.ReadRune()
+		if _, isFE := err.(fatalError); isFE {
+			return false, err
+		}
+		if err != nil || r != w {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Escaped matches a single character, returned as a string. If it is the
+// escape rune the following rune is consumed as well and translated through
+// mapping; an escape not in mapping is an error.
+func Escaped(escape rune, mapping map[rune]rune) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		r, _, err := sr.ReadRune()
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		if r != escape {
+			return runeMatch(r), nil
+		}
+		r, _, err = sr.ReadRune()
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		tr, ok := mapping[r]
+		if !ok {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Unknown escape %q", string([]rune{escape, r}))
+		}
+		return runeMatch(tr), nil
+	}
+}
+
+// readLine reads up to and including the next '\n', reporting whether the
+// end of input was reached before anything could be read. A fatal read error
+// is returned as is.
+func readLine(sr StateReader) (string, bool, error) {
+	rs := []rune{}
+	for {
+		state := sr.State()
+		r, _, err := sr.ReadRune()
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return "", false, err
+			}
+			sr.RestoreState(state)
+			return string(rs), len(rs) == 0, nil
+		}
+		rs = append(rs, r)
+		if r == '\n' {
+			return string(rs), false, nil
+		}
+	}
+}
+
+// Fenced matches a fenced block: a line starting with fence (anything after
+// the fence, such as a language name, is ignored), then every line up to a
+// line consisting of just fence. It returns the text between the two fence
+// lines. Reaching the end of input before the closing fence is an error.
+func Fenced(fence string) Grammar {
+	open := And(Lit(fence), Many(NotSet("\r\n")), EOL())
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		if _, err := open(sr); err != nil {
+			return nil, err
+		}
+		var body strings.Builder
+		for {
+			line, eof, err := readLine(sr)
+			if err != nil {
+				return nil, err
+			}
+			if eof {
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Unterminated block, expected closing %q", fence)
+			}
+			if strings.TrimRight(line, " \t\r\n") == fence {
+				return body.String(), nil
+			}
+			body.WriteString(line)
+		}
+	}
+}
+
+// NormalizeNewlines runs g and returns the text of its match, as String
+// would, with every "\r\n" and lone "\r" line ending replaced by "\n".
+func NormalizeNewlines(g Grammar) Grammar {
+	return Node(g, func(m interface{}) (interface{}, error) {
+		s := strings.ReplaceAll(String(m), "\r\n", "\n")
+		return strings.ReplaceAll(s, "\r", "\n"), nil
+	})
+}
+
+// BalancedBraces matches a block from { to its matching }, counting nested
+// braces, and returns the text between the outer braces verbatim. Matches
+// of stringG are treated as opaque, so braces inside string literals don't
+// affect the nesting. Reaching the end of input before the block closes is
+// an error.
+func BalancedBraces(stringG Grammar) Grammar {
+	str := Capture(stringG)
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		r, _, err := sr.ReadRune()
+		if _, isFE := err.(fatalError); isFE {
+			return nil, err
+		}
+		if err != nil || r != '{' {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Expected '{'")
+		}
+		var body strings.Builder
+		depth := 1
+		for {
+			before := sr.State()
+			if m, err := str(sr); err == nil {
+				// A zero-width string match would never advance the loop, so
+				// it's taken as no string at all.
+				if s := m.(string); s != "" {
+					body.WriteString(s)
+					continue
+				}
+			} else if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(before)
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Unterminated block, expected '}'")
+			}
+			switch r {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					return body.String(), nil
+				}
+			}
+			body.WriteRune(r)
+		}
+	}
+}
+
+// StartOfInput matches, without consuming anything, only at the very start
+// of the input. It requires a reader that tracks positions.
+func StartOfInput() Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		p := pos(sr)
+		if p < 0 {
+			return nil, fmt.Errorf("StartOfInput requires a reader that tracks positions")
+		}
+		if p != 0 {
+			return nil, fmt.Errorf("Expected start of input, at offset %d", p)
+		}
+		return nil, nil
+	}
+}
+
+// afterBOM matches, without consuming anything, just after a byte order
+// mark at the start of the input.
+var afterBOM = func(sr StateReader) (interface{}, error) {
+	if lb, ok := lookbehind(sr); ok && pos(sr) == len("\uFEFF") {
+		if r, ok := lb.PrevRune(); ok && r == '\uFEFF' {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("Expected start of input")
+}
+
+// Shebang matches a "#!" interpreter line at the start of the input, or
+// straight after a leading byte order mark, including its line ending, and
+// returns nil. Wrap it in Optional to skip a shebang only when present.
+func Shebang() Grammar {
+	return Ignore(And(Or(StartOfInput(), afterBOM), Lit("#!"), Many(NotSet("\r\n")), EOL()))
+}
+
+// IdentOptions configures Identifier. First and Rest decide which runes may
+// start and continue an identifier. If left nil they default to a letter
+// or '_', then letters, digits and '_', where letters and digits are ASCII
+// only unless Unicode is set.
+type IdentOptions struct {
+	First   func(rune) bool
+	Rest    func(rune) bool
+	Unicode bool
+}
+
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// Identifier matches an identifier as configured by opts and returns it as
+// a string.
+func Identifier(opts IdentOptions) Grammar {
+	letter, digit := isASCIILetter, isASCIIDigit
+	if opts.Unicode {
+		letter, digit = unicode.IsLetter, unicode.IsDigit
+	}
+	first, rest := opts.First, opts.Rest
+	if first == nil {
+		first = func(r rune) bool { return r == '_' || letter(r) }
+	}
+	if rest == nil {
+		rest = func(r rune) bool { return r == '_' || letter(r) || digit(r) }
+	}
+	return Capture(And(satisfy("identifier", first), Many(satisfy("identifier character", rest))))
+}
+
+var spaces = Many(space)
+
+// Trimmed matches g with any whitespace around it, returning just g's match.
+func Trimmed(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		if _, err := spaces(sr); err != nil {
+			return nil, err
+		}
+		m, err := g(sr)
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		if _, err := spaces(sr); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+// Spaced matches gs in sequence like And, allowing whitespace between
+// them. The whitespace is not part of the result.
+func Spaced(gs ...Grammar) Grammar {
+	return SpacedBy(space, gs...)
+}
+
+// SpacedBy is like Spaced, but skips any number of ws matches between the
+// elements instead of whitespace, so that comments can be skipped as well,
+// as in SpacedBy(Or(space, comment), ...).
+func SpacedBy(ws Grammar, gs ...Grammar) Grammar {
+	skip := SkipMany(ws)
+	seq := make([]Grammar, 0, 2*len(gs))
+	for i, g := range gs {
+		if i > 0 {
+			seq = append(seq, skip)
+		}
+		seq = append(seq, g)
+	}
+	return And(seq...)
+}
+
+func lookbehind(sr StateReader) (Lookbehind, bool) {
+	for {
+		if lb, ok := sr.(Lookbehind); ok {
+			return lb, true
+		}
+		w, ok := sr.(wrapper)
+		if !ok {
+			return nil, false
+		}
+		sr = w.unwrap()
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || isASCIILetter(r) || isASCIIDigit(r)
+}
+
+// WordBoundary matches, without consuming anything, between a word rune and
+// a non-word rune, or between a word rune and the start or end of input,
+// like \b in regexp. Word runes are ASCII letters, digits and '_'. It
+// requires a reader implementing Lookbehind.
+func WordBoundary() Grammar {
+	return WordBoundaryFunc(isWordRune)
+}
+
+// WordBoundaryFunc is like WordBoundary, but isWord decides which runes are
+// word runes.
+func WordBoundaryFunc(isWord func(rune) bool) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		lb, ok := lookbehind(sr)
+		if !ok {
+			return nil, fmt.Errorf("WordBoundary requires a reader implementing Lookbehind")
+		}
+		prev, ok := lb.PrevRune()
+		before := ok && isWord(prev)
+		state := sr.State()
+		next, _, err := sr.ReadRune()
+		if _, isFE := err.(fatalError); isFE {
+			return nil, err
+		}
+		sr.RestoreState(state)
+		after := err == nil && isWord(next)
+		if before == after {
+			return nil, fmt.Errorf("Expected word boundary")
+		}
+		return nil, nil
+	}
+}
+
+var bom = Lit("\uFEFF")
+
+// OptionalBOM consumes a UTF-8 byte order mark if one is next, and returns
+// nil either way.
+func OptionalBOM() Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		if _, err := bom(sr); err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+}
+
+// Quoted matches text between the open and close runes and returns it with
+// escapes decoded. After the escape rune, 'n', 't' and 'r' stand for
+// newline, tab and carriage return, and the escape, open and close runes
+// stand for themselves; any other escape is an error, as is reaching the
+// end of input before close.
+func Quoted(open, close, escape rune) Grammar {
+	mapping := map[rune]rune{
+		'n':    '\n',
+		't':    '\t',
+		'r':    '\r',
+		escape: escape,
+		open:   open,
+		close:  close,
+	}
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		r, _, err := sr.ReadRune()
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		if r != open {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Expected %q, got %q", open, r)
+		}
+		body := []rune{}
+		for {
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Unterminated quoted string, expected %q", close)
+			}
+			switch r {
+			case close:
+				return string(body), nil
+			case escape:
+				e, _, err := sr.ReadRune()
+				if err != nil {
+					if _, isFE := err.(fatalError); isFE {
+						return nil, err
+					}
+					sr.RestoreState(state)
+					return nil, fmt.Errorf("Unterminated quoted string, expected %q", close)
+				}
+				tr, ok := mapping[e]
+				if !ok {
+					sr.RestoreState(state)
+					return nil, fmt.Errorf("Unknown escape %q", string([]rune{escape, e}))
+				}
+				body = append(body, tr)
+			default:
+				body = append(body, r)
+			}
+		}
+	}
+}
+
+// QuotedString matches a double-quoted string with backslash escapes, as
+// described for Quoted.
+func QuotedString() Grammar {
+	return Quoted('"', '"', '\\')
+}
+
+// RawString matches a raw string literal between two delim runes, like a Go
+// backtick string, and returns its content verbatim with no escapes
+// interpreted. Reaching the end of input before the closing delim is an
+// error.
+func RawString(delim rune) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		r, _, err := sr.ReadRune()
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		if r != delim {
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Expected %q, got %q", delim, r)
+		}
+		body := []rune{}
+		for {
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(state)
+				return nil, fmt.Errorf("Unterminated raw string, expected %q", delim)
+			}
+			if r == delim {
+				return string(body), nil
+			}
+			body = append(body, r)
+		}
+	}
+}
+
+// AtEnd matches g only if it is immediately followed by the end of input,
+// and otherwise fails without consuming anything.
+func AtEnd(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := g(sr)
+		if err != nil {
+			return nil, err
+		}
+		after := sr.State()
+		if _, _, err := sr.ReadRune(); err != io.EOF {
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			return nil, fmt.Errorf("Expected end of input")
+		}
+		sr.RestoreState(after)
+		return m, nil
+	}
+}
+
+// LineContinuation matches a backslash immediately followed by a line
+// ending ("\n" or "\r\n") and returns nil, so continued lines can be
+// joined.
+func LineContinuation() Grammar {
+	return LineContinuationRune('\\')
+}
+
+// LineContinuationRune is like LineContinuation with cont in place of the
+// backslash.
+func LineContinuationRune(cont rune) Grammar {
+	return Ignore(And(Lit(string(cont)), Or(Lit("\n"), Lit("\r\n"))))
+}
+
+// EscapeTable describes the escapes Unescape decodes. Escape introduces an
+// escape, defaulting to '\' if zero. Simple maps the rune after Escape to
+// its replacement, and Hex maps it to a number of hex digits that follow and
+// give the code point of the replacement, as with \xHH or \uHHHH.
+type EscapeTable struct {
+	Escape rune
+	Simple map[rune]string
+	Hex    map[rune]int
+}
+
+// Unescape reads runes up to the point where stop would match, or the end of
+// input, decoding escapes according to table, and returns the decoded text.
+// stop itself is not consumed. An escape not in table is an error.
+func Unescape(table EscapeTable, stop Grammar) Grammar {
+	escape := table.Escape
+	if escape == 0 {
+		escape = '\\'
+	}
+	return func(sr StateReader) (interface{}, error) {
+		start := sr.State()
+		var out strings.Builder
+		for {
+			state := sr.State()
+			if _, err := stop(sr); err == nil {
+				sr.RestoreState(state)
+				return out.String(), nil
+			} else if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(state)
+				return out.String(), nil
+			}
+			if r != escape {
+				out.WriteRune(r)
+				continue
+			}
+			e, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(start)
+				return nil, fmt.Errorf("Incomplete escape at end of input")
+			}
+			if s, ok := table.Simple[e]; ok {
+				out.WriteString(s)
+				continue
+			}
+			n, ok := table.Hex[e]
+			if !ok {
+				sr.RestoreState(start)
+				return nil, fmt.Errorf("Unknown escape %q", string([]rune{escape, e}))
+			}
+			var cp rune
+			for i := 0; i < n; i++ {
+				h, _, err := sr.ReadRune()
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				d, ok := unhex(h)
+				if err != nil || !ok {
+					sr.RestoreState(start)
+					return nil, fmt.Errorf("Expected %d hex digits after %q", n, string([]rune{escape, e}))
+				}
+				cp = cp<<4 | rune(d)
+			}
+			out.WriteRune(cp)
+		}
+	}
+}
+
+// BlankLine matches a line containing only spaces and tabs, including its
+// line ending, and returns nil.
+func BlankLine() Grammar {
+	return Ignore(And(Many(Set(" \t")), Or(Lit("\n"), Lit("\r\n"))))
+}
+
+// SkipMany matches g zero or more times and returns nil. Unlike
+// Ignore(Many(g)) it doesn't collect g's matches, so Capture(SkipMany(g))
+// captures a long run of g without building a slice of it. Like Mult, it
+// stops once g matches without consuming input.
+func SkipMany(g Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		for {
+			before := pos(sr)
+			if _, err := g(sr); err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				return nil, nil
+			}
+			if before >= 0 && pos(sr) == before {
+				return nil, nil
+			}
+		}
+	}
+}
+
+// Skip tries each of gs in turn, skipping any that don't match, and returns
+// nil. It is meant for optional preamble such as
+// Skip(OptionalBOM(), Shebang(), SkipMany(BlankLine())).
+func Skip(gs ...Grammar) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		for _, g := range gs {
+			state := sr.State()
+			if _, err := g(sr); err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				sr.RestoreState(state)
+			}
+		}
+		return nil, nil
+	}
+}
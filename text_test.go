@@ -0,0 +1,476 @@
+package stateparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWhitespace(t *testing.T) {
+	tests := []struct {
+		g     Grammar
+		input string
+		want  string
+		ok    bool
+	}{
+		{Whitespace1(), " \t\n \r\nx", " \t\n \r\n", true},
+		{Whitespace1(), "\tx", "\t", true},
+		{Whitespace1(), "x", "", false},
+		{Whitespace1(), "", "", false},
+		{Whitespace0(), "\n\t y", "\n\t ", true},
+		{Whitespace0(), "y", "", true},
+		{Whitespace0(), "", "", true},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := tt.g(sr)
+		if (err == nil) != tt.ok {
+			t.Errorf("on %q: err = %v, want success %v", tt.input, err, tt.ok)
+			continue
+		}
+		if tt.ok && (m != tt.want || sr.Pos() != len(tt.want)) {
+			t.Errorf("on %q = %q up to %d, want %q", tt.input, m, sr.Pos(), tt.want)
+		}
+	}
+}
+
+func TestRest(t *testing.T) {
+	m, err := Parse(And(LitIgnore("MSG "), Rest()), "MSG hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms := m.([]interface{}); len(ms) != 1 || ms[0] != "hello world" {
+		t.Errorf("Rest = %#v, want %q", m, "hello world")
+	}
+	if m, err := Parse(And(Lit("MSG"), Rest()), "MSG"); err != nil || m.([]interface{})[1] != "" {
+		t.Errorf("Rest at end = %#v, %v", m, err)
+	}
+}
+
+func TestEscaped(t *testing.T) {
+	g := Escaped('\\', map[rune]rune{'n': '\n', 't': '\t', '\\': '\\'})
+	tests := []struct {
+		input, want string
+		pos         int
+	}{
+		{`\n`, "\n", 2},
+		{`\\x`, `\`, 2},
+		{`ab`, "a", 1},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := g(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.pos {
+			t.Errorf("Escaped on %q = %q, %v up to %d, want %q up to %d", tt.input, m, err, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, input := range []string{`\q`, `\`, ``} {
+		sr := NewStringReader(input)
+		if _, err := g(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("Escaped on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+	if _, err := Parse(g, `\q`); err == nil || !strings.Contains(err.Error(), `Unknown escape "\\q"`) {
+		t.Errorf("unknown escape error = %v", err)
+	}
+}
+
+func TestFenced(t *testing.T) {
+	tests := []struct {
+		input, want string
+		pos         int
+	}{
+		{"```go\nfmt.Println()\n\nx := 1\n```\nafter", "fmt.Println()\n\nx := 1\n", 32},
+		{"```\n```", "", 7},
+		{"~~~\r\na ~~~\r\n~~~\r\n", "a ~~~\r\n", 17},
+	}
+	for _, tt := range tests {
+		fence := tt.input[:3]
+		sr := NewStringReader(tt.input)
+		m, err := Fenced(fence)(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.pos {
+			t.Errorf("Fenced on %q = %q, %v up to %d, want %q up to %d", tt.input, m, err, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, input := range []string{"```go\ncode\n", "```go\ncode\n``", "no fence"} {
+		sr := NewStringReader(input)
+		if _, err := Fenced("```")(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("Fenced on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+	_, err := Parse(Fenced("```"), "```\nunterminated")
+	if err == nil || !strings.Contains(err.Error(), "Unterminated block") {
+		t.Errorf("unterminated error = %v", err)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	stmt := Capture(Many1(NotSet("\n")))
+	g := And(Optional(Shebang()), stmt)
+	for _, tt := range []struct{ input, want string }{
+		{"#!/usr/bin/env calc\n1 + 2", "1 + 2"},
+		{"1 + 2", "1 + 2"},
+		{"#!calc\r\nx #! y", "x #! y"},
+	} {
+		m, err := Parse(g, tt.input)
+		if err != nil {
+			t.Errorf("on %q: %v", tt.input, err)
+			continue
+		}
+		if ms := m.([]interface{}); String(ms[len(ms)-1]) != tt.want {
+			t.Errorf("on %q = %#v, want %q after the shebang", tt.input, m, tt.want)
+		}
+	}
+	// A "#!" line anywhere but the start is not a shebang.
+	sr := NewStringReader("x\n#!sh\n")
+	if _, err := Lit("x\n")(sr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Shebang()(sr); err == nil {
+		t.Error("Shebang matched after the start of input")
+	}
+	if _, err := Parse(And(Lit("a"), StartOfInput()), "a"); err == nil {
+		t.Error("StartOfInput matched at offset 1")
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	ascii := Identifier(IdentOptions{})
+	uni := Identifier(IdentOptions{Unicode: true})
+	dashed := Identifier(IdentOptions{Rest: func(r rune) bool { return r == '-' || isASCIILetter(r) }})
+	tests := []struct {
+		g           Grammar
+		input, want string
+	}{
+		{ascii, "foo_bar2 = 1", "foo_bar2"},
+		{ascii, "_private", "_private"},
+		{ascii, "__init__()", "__init__"},
+		{ascii, "naïve", "na"},
+		{uni, "naïve x", "naïve"},
+		{uni, "変数1+", "変数1"},
+		{dashed, "kebab-case2", "kebab-case"},
+	}
+	for _, tt := range tests {
+		if m, err := Parse(tt.g, tt.input); err != nil || m != tt.want {
+			t.Errorf("Identifier on %q = %v, %v, want %q", tt.input, m, err, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		g     Grammar
+		input string
+	}{
+		{ascii, "1abc"},
+		{ascii, "ïx"},
+		{uni, "٣x"},
+		{ascii, ""},
+	} {
+		if m, err := Parse(tt.g, tt.input); err == nil {
+			t.Errorf("Identifier matched %q as %v", tt.input, m)
+		}
+	}
+}
+
+func TestTrimmed(t *testing.T) {
+	sr := NewStringReader("   42   ")
+	m, err := Trimmed(Int())(sr)
+	if err != nil || m != 42 || sr.Pos() != 8 {
+		t.Errorf("Trimmed = %v, %v up to %d, want 42 up to 8", m, err, sr.Pos())
+	}
+	sr = NewStringReader("\t7\n,")
+	if m, err := Trimmed(Int())(sr); err != nil || m != 7 || sr.Pos() != 3 {
+		t.Errorf("Trimmed = %v, %v up to %d, want 7 up to 3", m, err, sr.Pos())
+	}
+	sr = NewStringReader("  x")
+	if _, err := Trimmed(Int())(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("Trimmed = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestWordBoundary(t *testing.T) {
+	at := func(input string, p int, g Grammar) bool {
+		sr := NewStringReader(input)
+		sr.pos = p
+		_, err := g(sr)
+		if sr.Pos() != p {
+			t.Errorf("WordBoundary on %q consumed input", input)
+		}
+		return err == nil
+	}
+	tests := []struct {
+		input string
+		pos   int
+		want  bool
+	}{
+		{"cat dog", 0, true},
+		{"cat dog", 1, false},
+		{"cat dog", 3, true},
+		{"cat dog", 4, true},
+		{"cat dog", 7, true},
+		{"a  b", 2, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		if got := at(tt.input, tt.pos, WordBoundary()); got != tt.want {
+			t.Errorf("WordBoundary on %q at %d = %v, want %v", tt.input, tt.pos, got, tt.want)
+		}
+	}
+	// With '-' counted as a word rune, "kebab-case" has no inner boundary.
+	dashed := WordBoundaryFunc(func(r rune) bool { return r == '-' || isWordRune(r) })
+	if at("kebab-case", 5, dashed) || !at("kebab-case", 5, WordBoundary()) {
+		t.Error("WordBoundaryFunc ignored its predicate")
+	}
+}
+
+func TestOptionalBOM(t *testing.T) {
+	for _, input := range []string{"\uFEFFkey", "key"} {
+		m, err := Parse(And(OptionalBOM(), Capture(Many1(Set("a-z")))), input)
+		if err != nil {
+			t.Errorf("on %q: %v", input, err)
+			continue
+		}
+		if ms := m.([]interface{}); len(ms) != 1 || ms[0] != "key" {
+			t.Errorf("on %q = %#v, want just %q", input, m, "key")
+		}
+	}
+	sr := NewStringReader("k\uFEFF")
+	if m, err := OptionalBOM()(sr); err != nil || m != nil || sr.Pos() != 0 {
+		t.Errorf("OptionalBOM without BOM = %v, %v up to %d", m, err, sr.Pos())
+	}
+}
+
+func TestQuoted(t *testing.T) {
+	tests := []struct {
+		g           Grammar
+		input, want string
+	}{
+		{Quoted('`', '`', '\\'), "`a \\` b`", "a ` b"},
+		{Quoted('«', '»', '\\'), "«il a dit \\«oui\\»»", "il a dit «oui»"},
+		{Quoted('«', '»', '^'), "«x^ny^^»", "x\ny^"},
+		{QuotedString(), `"tab\there" rest`, "tab\there"},
+		{QuotedString(), `""`, ""},
+	}
+	for _, tt := range tests {
+		if m, err := Parse(tt.g, tt.input); err != nil || m != tt.want {
+			t.Errorf("on %q = %q, %v, want %q", tt.input, m, err, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		g          Grammar
+		input, err string
+	}{
+		{Quoted('«', '»', '\\'), "«open", "Unterminated quoted string"},
+		{Quoted('«', '»', '\\'), "«open\\", "Unterminated quoted string"},
+		{QuotedString(), `"bad \q"`, `Unknown escape "\\q"`},
+		{QuotedString(), `'x'`, "Expected"},
+	} {
+		sr := NewStringReader(tt.input)
+		_, err := tt.g(sr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) || sr.Pos() != 0 {
+			t.Errorf("on %q = %v at %d, want %q at 0", tt.input, err, sr.Pos(), tt.err)
+		}
+	}
+}
+
+func TestRawString(t *testing.T) {
+	sr := NewStringReader("`C:\\path\\n \\t \"q\"` rest")
+	m, err := RawString('`')(sr)
+	if want := `C:\path\n \t "q"`; err != nil || m != want {
+		t.Errorf("RawString = %q, %v, want %q", m, err, want)
+	}
+	if sr.Pos() != 18 {
+		t.Errorf("RawString stopped at %d, want 18", sr.Pos())
+	}
+	if m, err := Parse(RawString('`'), "`line\nbreak`"); err != nil || m != "line\nbreak" {
+		t.Errorf("multi-line RawString = %q, %v", m, err)
+	}
+	for _, input := range []string{"`open \\", "\"x\""} {
+		sr := NewStringReader(input)
+		if _, err := RawString('`')(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("RawString on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+}
+
+func TestAtEnd(t *testing.T) {
+	stmt := Capture(Many1(Set("a-z")))
+	// A statement must be followed by ';', except the last, where it may be
+	// left off.
+	g := Many(Or(And(stmt, Lit(";")), AtEnd(stmt)))
+	for _, input := range []string{"a;b;c", "a;b;c;", "a", ""} {
+		if _, err := Parse(AtEnd(g), input); err != nil {
+			t.Errorf("on %q: %v", input, err)
+		}
+	}
+	if _, err := Parse(AtEnd(g), "a b;"); err == nil {
+		t.Error("statement without ';' accepted before the end")
+	}
+	sr := NewStringReader("ab;")
+	if _, err := AtEnd(stmt)(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("AtEnd = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestLineContinuation(t *testing.T) {
+	word := Capture(Many1(Set("a-z")))
+	line := Many1(Or(word, LineContinuation()))
+	for _, input := range []string{"a\\\nb", "a\\\r\nb"} {
+		m, err := Parse(AtEnd(line), input)
+		if err != nil || String(m) != "ab" {
+			t.Errorf("on %q = %#v, %v, want the lines joined", input, m, err)
+		}
+	}
+	if _, err := Parse(AtEnd(line), "a\\ b"); err == nil {
+		t.Error("backslash not followed by a newline accepted")
+	}
+	if m, err := Parse(AtEnd(Many1(Or(word, LineContinuationRune('`')))), "a`\nb"); err != nil || String(m) != "ab" {
+		t.Errorf("LineContinuationRune = %#v, %v", m, err)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	table := EscapeTable{
+		Simple: map[rune]string{'n': "\n", '"': `"`, '\\': `\`},
+		Hex:    map[rune]int{'x': 2, 'u': 4},
+	}
+	g := Unescape(table, Lit(`"`))
+	tests := []struct {
+		input, want string
+		pos         int
+	}{
+		{`a\nb\x41é世\"\\"rest`, "a\nbAé世\"\\", 17},
+		{`plain`, "plain", 5},
+		{`"`, "", 0},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := g(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.pos {
+			t.Errorf("Unescape on %q = %q, %v up to %d, want %q up to %d", tt.input, m, err, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	if m, err := Parse(Unescape(EscapeTable{Escape: '%', Hex: map[rune]int{'%': 2}}, Lit(";")), "a%%41;"); err != nil || m != "aA" {
+		t.Errorf("custom escape = %q, %v", m, err)
+	}
+	for _, tt := range []struct{ input, err string }{
+		{`a\q"`, `Unknown escape "\\q"`},
+		{`a\x4"`, `Expected 2 hex digits after "\\x"`},
+		{`a\`, "Incomplete escape"},
+	} {
+		sr := NewStringReader(tt.input)
+		_, err := g(sr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) || sr.Pos() != 0 {
+			t.Errorf("Unescape on %q = %v at %d, want %q at 0", tt.input, err, sr.Pos(), tt.err)
+		}
+	}
+}
+
+func TestSkipPreamble(t *testing.T) {
+	preamble := Skip(OptionalBOM(), Shebang(), SkipMany(BlankLine()))
+	body := Capture(Rest())
+	g := And(preamble, body)
+	for _, input := range []string{
+		"\uFEFF#!/bin/prog\n\n  \t\r\nmain",
+		"#!/bin/prog\nmain",
+		"\uFEFF\n\nmain",
+		"\n  \nmain",
+		"main",
+	} {
+		m, err := Parse(g, input)
+		if err != nil {
+			t.Errorf("on %q: %v", input, err)
+			continue
+		}
+		if ms := m.([]interface{}); len(ms) != 1 || ms[0] != "main" {
+			t.Errorf("on %q = %#v, want only %q", input, m, "main")
+		}
+	}
+	if m, err := Parse(preamble, ""); err != nil || m != nil {
+		t.Errorf("Skip on empty input = %#v, %v", m, err)
+	}
+}
+
+func TestUpTo(t *testing.T) {
+	sr := NewStringReader("some EN text ENDEND")
+	m, err := UpTo("END")(sr)
+	if err != nil || m != "some EN text " || sr.Pos() != 13 {
+		t.Errorf("UpTo = %q, %v up to %d", m, err, sr.Pos())
+	}
+	if m, err := Parse(UpTo("END"), "END"); err != nil || m != "" {
+		t.Errorf("UpTo at the sentinel = %q, %v", m, err)
+	}
+	if m, err := Parse(UpTo("aab"), "aaab"); err != nil || m != "a" {
+		t.Errorf("UpTo with overlapping prefix = %q, %v", m, err)
+	}
+	sr = NewStringReader("no sentinel EN")
+	_, err = UpTo("END")(sr)
+	if err == nil || err.Error() != `Expected "END" before end of input` || sr.Pos() != 0 {
+		t.Errorf("UpTo without sentinel = %v at %d", err, sr.Pos())
+	}
+}
+
+func TestSpaced(t *testing.T) {
+	g := Spaced(Lit("a"), Lit("b"), Lit("c"))
+	for _, input := range []string{"a  b\tc", "abc", "a\n\nb c"} {
+		m, err := Parse(AtEnd(g), input)
+		if err != nil || String(m) != "abc" || len(m.([]interface{})) != 3 {
+			t.Errorf("Spaced on %q = %#v, %v", input, m, err)
+		}
+	}
+	if _, err := Parse(g, " abc"); err == nil {
+		t.Error("Spaced skipped leading whitespace")
+	}
+	comment := And(Lit("/*"), UpTo("*/"), Lit("*/"))
+	g = SpacedBy(Or(space, comment), Lit("a"), Lit("b"))
+	if m, err := Parse(AtEnd(g), "a /* x */ /**/b"); err != nil || String(m) != "ab" {
+		t.Errorf("SpacedBy = %#v, %v", m, err)
+	}
+}
+
+func TestBalancedBraces(t *testing.T) {
+	g := BalancedBraces(QuotedString())
+	sr := NewStringReader(`{ if x { print("}") } else { y = "{" } } tail`)
+	m, err := g(sr)
+	if want := ` if x { print("}") } else { y = "{" } `; err != nil || m != want {
+		t.Errorf("BalancedBraces = %q, %v, want %q", m, err, want)
+	}
+	if sr.Pos() != 40 {
+		t.Errorf("BalancedBraces stopped at %d, want 40", sr.Pos())
+	}
+	if m, err := Parse(g, "{}"); err != nil || m != "" {
+		t.Errorf("empty block = %q, %v", m, err)
+	}
+	for _, input := range []string{`{ a { b }`, `{ "}"`, `x{}`} {
+		sr := NewStringReader(input)
+		if _, err := g(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("BalancedBraces on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+	// A string grammar that can match empty mustn't stall the loop.
+	if m, err := Parse(BalancedBraces(Optional(QuotedString())), `{a "}" {b}}`); err != nil || m != `a "}" {b}` {
+		t.Errorf("BalancedBraces(Optional) = %q, %v", m, err)
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	g := NormalizeNewlines(Rest())
+	if m, err := Parse(g, "a\r\nb\nc\rd\r\n\re"); err != nil || m != "a\nb\nc\nd\n\ne" {
+		t.Errorf("NormalizeNewlines = %q, %v", m, err)
+	}
+	if m, err := Parse(NormalizeNewlines(Fenced("```")), "```\r\nx\r\ny\n```"); err != nil || m != "x\ny\n" {
+		t.Errorf("NormalizeNewlines over Fenced = %q, %v", m, err)
+	}
+}
+
+func TestSkipMany(t *testing.T) {
+	sr := NewStringReader("aaab")
+	if m, err := SkipMany(Lit("a"))(sr); err != nil || m != nil || sr.Pos() != 3 {
+		t.Errorf("SkipMany = %v, %v at %d, want nil at 3", m, err, sr.Pos())
+	}
+	// A grammar that matches empty ends the loop instead of spinning.
+	sr = NewStringReader("aab")
+	if _, err := SkipMany(Optional(Lit("a")))(sr); err != nil || sr.Pos() != 2 {
+		t.Errorf("SkipMany(Optional) = %v at %d, want 2", err, sr.Pos())
+	}
+	if _, err := Parse(SkipMany(Lit("a")), "aaaa", MaxSteps(2)); err == nil || !strings.Contains(err.Error(), "Step limit") {
+		t.Errorf("SkipMany swallowed a fatal error: %v", err)
+	}
+}
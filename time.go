@@ -0,0 +1,110 @@
+package stateparser
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	// layoutFraction finds a fractional seconds element, such as ".000" or
+	// ",999", in a time.Parse layout.
+	layoutFraction = regexp.MustCompile(`[.,](0+|9+)([^0-9]|$)`)
+	inputFraction  = regexp.MustCompile(`[.,][0-9]+`)
+)
+
+// beyondLayout reports whether text parses as t only thanks to time.Parse
+// accepting fractional seconds that layout doesn't contain: whether some
+// run of fractional digits can be cut out of text leaving the same time.
+func beyondLayout(layout, text string, t time.Time) bool {
+	if t.Nanosecond() != 0 {
+		return true
+	}
+	for _, loc := range inputFraction.FindAllStringIndex(text, -1) {
+		u, err := time.Parse(layout, text[:loc[0]]+text[loc[1]:])
+		if err == nil && u.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// DateTime matches a timestamp in the given time.Parse layout and returns it
+// as a time.Time. Since layout elements such as month names, unpadded numbers
+// and zone abbreviations vary in width, DateTime consumes the longest prefix
+// of the input that parses. Fractional seconds are only consumed if layout
+// has them, although time.Parse would accept them anyway.
+func DateTime(layout string) Grammar {
+	maxLen := len([]rune(layout)) + 16
+	exact := !layoutFraction.MatchString(layout)
+	return func(sr StateReader) (interface{}, error) {
+		start := sr.State()
+		done := speculate(sr)
+		defer done()
+		states := make([]interface{}, 0, maxLen)
+		rs := make([]rune, 0, maxLen)
+		for len(rs) < maxLen {
+			r, _, err := sr.ReadRune()
+			if err != nil {
+				if _, isFE := err.(fatalError); isFE {
+					return nil, err
+				}
+				break
+			}
+			rs = append(rs, r)
+			states = append(states, sr.State())
+		}
+		var lastErr error
+		for n := len(rs); n > 0; n-- {
+			text := string(rs[:n])
+			t, err := time.Parse(layout, text)
+			if err == nil && exact && beyondLayout(layout, text, t) {
+				continue
+			}
+			if err == nil {
+				sr.RestoreState(states[n-1])
+				return t, nil
+			}
+			if lastErr == nil {
+				lastErr = err
+			}
+		}
+		sr.RestoreState(start)
+		if lastErr == nil {
+			return nil, fmt.Errorf("Expected a time in layout %q, got end of input", layout)
+		}
+		return nil, fmt.Errorf("Expected a time in layout %q: %s", layout, lastErr)
+	}
+}
+
+var durationToken = Label("duration", Capture(And(
+	Optional(Set("+-")),
+	Or(
+		Many1(And(
+			Or(
+				And(Many1(Set("0-9")), Optional(And(Lit("."), Many(Set("0-9"))))),
+				And(Lit("."), Many1(Set("0-9"))),
+			),
+			LongestPrefix("ns", "us", "µs", "μs", "ms", "s", "m", "h"),
+		)),
+		Lit("0"),
+	),
+)))
+
+// Duration matches a duration in the syntax of time.ParseDuration, such as
+// "1h30m" or "500ms", and returns it as a time.Duration.
+func Duration() Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := durationToken(sr)
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(m.(string))
+		if err != nil {
+			sr.RestoreState(state)
+			return nil, err
+		}
+		return d, nil
+	}
+}
@@ -0,0 +1,73 @@
+package stateparser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateTime(t *testing.T) {
+	tests := []struct {
+		layout, input string
+		want          time.Time
+		pos           int
+	}{
+		{"2006-01-02", "2024-03-15 rest", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), 10},
+		{"15:04:05", "23:59:01Z", time.Date(0, 1, 1, 23, 59, 1, 0, time.UTC), 8},
+		{"2006-01-02T15:04:05Z07:00", "2024-03-15T10:00:00+02:00;", time.Date(2024, 3, 15, 8, 0, 0, 0, time.UTC), 25},
+		{"Jan 2 2006", "Mar 5 2024.", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), 10},
+		// time.Parse accepts fractional seconds the layout doesn't have, but
+		// they are left unconsumed.
+		{"15:04:05", "12:30:45.999 rest", time.Date(0, 1, 1, 12, 30, 45, 0, time.UTC), 8},
+		{"15:04:05", "12:30:45,000", time.Date(0, 1, 1, 12, 30, 45, 0, time.UTC), 8},
+		{"15:04:05.000", "12:30:45.250 rest", time.Date(0, 1, 1, 12, 30, 45, 250e6, time.UTC), 12},
+		{"2006.01.02", "2024.03.15.", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), 10},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := DateTime(tt.layout)(sr)
+		if err != nil {
+			t.Errorf("DateTime(%q) on %q: %v", tt.layout, tt.input, err)
+			continue
+		}
+		if got := m.(time.Time); !got.Equal(tt.want) || sr.Pos() != tt.pos {
+			t.Errorf("DateTime(%q) on %q = %v up to %d, want %v up to %d", tt.layout, tt.input, got, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, input := range []string{"2024-13-01", "2024-3-x", "24-03-15", ""} {
+		sr := NewStringReader(input)
+		if m, err := DateTime("2006-01-02")(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("DateTime on %q = %v, %v at %d, want failure at 0", input, m, err, sr.Pos())
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+		pos   int
+	}{
+		{"1h30m", 90 * time.Minute, 5},
+		{"500ms;", 500 * time.Millisecond, 5},
+		{"-1.5s", -1500 * time.Millisecond, 5},
+		{"0 ", 0, 1},
+		{"2µs", 2 * time.Microsecond, 4},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := Duration()(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.pos {
+			t.Errorf("Duration on %q = %v, %v up to %d, want %v up to %d", tt.input, m, err, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, input := range []string{"30", "h", "1x", "", "5 s"} {
+		sr := NewStringReader(input)
+		if m, err := Duration()(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("Duration on %q = %v, %v at %d, want failure at 0", input, m, err, sr.Pos())
+		}
+	}
+	g := Or(Duration(), Int())
+	if m, err := Parse(g, "30"); err != nil || m != 30 {
+		t.Errorf("Or(Duration, Int) = %v, %v", m, err)
+	}
+}
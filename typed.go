@@ -0,0 +1,43 @@
+package stateparser
+
+// RepeatAs matches g zero or more times, like Many, converting each match
+// with conv and returning them as a []T. A conversion error fails the match.
+func RepeatAs[T any](g Grammar, conv func(interface{}) (T, error)) Grammar {
+	many := Many(g)
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := many(sr)
+		if err != nil {
+			return nil, err
+		}
+		ms := m.([]interface{})
+		out := make([]T, len(ms))
+		for i, mi := range ms {
+			out[i], err = conv(mi)
+			if err != nil {
+				sr.RestoreState(state)
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+}
+
+// OptionalAs matches g zero or one times, returning conv of its match, or
+// the zero value of T if g does not match. The result is always a T, never
+// a slice or nil.
+func OptionalAs[T any](g Grammar, conv func(interface{}) T) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		state := sr.State()
+		m, err := g(sr)
+		if err != nil {
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			sr.RestoreState(state)
+			var zero T
+			return zero, nil
+		}
+		return conv(m), nil
+	}
+}
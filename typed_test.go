@@ -0,0 +1,59 @@
+package stateparser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRepeatAs(t *testing.T) {
+	toInt := func(m interface{}) (int, error) {
+		return m.([]interface{})[0].(int), nil
+	}
+	g := RepeatAs(And(Int(), Optional(Lit(","))), toInt)
+	m, err := Parse(g, "1,22,-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := m.([]int); !ok || !reflect.DeepEqual(got, []int{1, 22, -3}) {
+		t.Errorf("RepeatAs = %#v, want []int{1, 22, -3}", m)
+	}
+	if m, err := Parse(g, "x"); err != nil || len(m.([]int)) != 0 {
+		t.Errorf("RepeatAs with no matches = %#v, %v", m, err)
+	}
+
+	small := RepeatAs(Int(), func(m interface{}) (int, error) {
+		if m.(int) > 9 {
+			return 0, fmt.Errorf("%d is too big", m)
+		}
+		return m.(int), nil
+	})
+	sr := NewStringReader("12")
+	if _, err := small(sr); err == nil || sr.Pos() != 0 {
+		t.Errorf("RepeatAs with a failing conversion = %v at %d, want failure at 0", err, sr.Pos())
+	}
+}
+
+func TestOptionalAs(t *testing.T) {
+	port := OptionalAs(And(LitIgnore(":"), Int()), func(m interface{}) int {
+		return m.([]interface{})[0].(int)
+	})
+	g := And(Capture(Many1(Set("a-z."))), port)
+	for _, tt := range []struct {
+		input string
+		want  int
+	}{{"example.com:8080", 8080}, {"example.com", 0}} {
+		m, err := Parse(g, tt.input)
+		if err != nil {
+			t.Errorf("on %q: %v", tt.input, err)
+			continue
+		}
+		if got := m.([]interface{})[1]; got != tt.want {
+			t.Errorf("on %q port = %#v, want %d", tt.input, got, tt.want)
+		}
+	}
+	sr := NewStringReader(":x")
+	if m, err := port(sr); err != nil || m != 0 || sr.Pos() != 0 {
+		t.Errorf("OptionalAs on a partial match = %#v, %v up to %d", m, err, sr.Pos())
+	}
+}
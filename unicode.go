@@ -0,0 +1,29 @@
+package stateparser
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// Category matches a single rune in the named Unicode category ("L", "Nd",
+// "Lu", ...) or script ("Latin", "Han", ...). It panics if name is neither.
+func Category(name string) Grammar {
+	rt, ok := unicode.Categories[name]
+	if !ok {
+		rt, ok = unicode.Scripts[name]
+	}
+	if !ok {
+		panic(fmt.Sprintf("stateparser: unknown Unicode category or script %q", name))
+	}
+	return satisfy(fmt.Sprintf("a rune in category %s", name), func(r rune) bool {
+		return unicode.Is(rt, r)
+	})
+}
+
+// RangeTable matches a single rune in rt, such as unicode.Han or a custom
+// table, without going through a regexp.
+func RangeTable(rt *unicode.RangeTable) Grammar {
+	return satisfy("a rune in the range table", func(r rune) bool {
+		return unicode.Is(rt, r)
+	})
+}
@@ -0,0 +1,59 @@
+package stateparser
+
+import (
+	"testing"
+	"unicode"
+)
+
+func TestCategory(t *testing.T) {
+	tests := []struct {
+		name  string
+		match []string
+		miss  []string
+	}{
+		{"L", []string{"a", "Z", "é", "世"}, []string{"1", " ", "-"}},
+		{"Lu", []string{"A", "É"}, []string{"a"}},
+		{"Nd", []string{"7", "٣"}, []string{"x", "Ⅻ"}},
+		{"Han", []string{"世"}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		g := Category(tt.name)
+		for _, s := range tt.match {
+			if m, err := Parse(g, s); err != nil || m != s {
+				t.Errorf("Category(%q) on %q = %v, %v", tt.name, s, m, err)
+			}
+		}
+		for _, s := range tt.miss {
+			sr := NewStringReader(s)
+			if _, err := g(sr); err == nil || sr.Pos() != 0 {
+				t.Errorf("Category(%q) on %q = %v at %d, want failure at 0", tt.name, s, err, sr.Pos())
+			}
+		}
+	}
+}
+
+func TestCategoryUnknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Category with an unknown name did not panic")
+		}
+	}()
+	Category("NotACategory")
+}
+
+func TestRangeTable(t *testing.T) {
+	han := RangeTable(unicode.Han)
+	if m, err := Parse(Capture(Many1(han)), "漢字abc"); err != nil || m != "漢字" {
+		t.Errorf("RangeTable = %v, %v", m, err)
+	}
+	for _, input := range []string{"a", "Z", "é", ""} {
+		sr := NewStringReader(input)
+		if _, err := han(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("RangeTable on %q = %v at %d, want failure at 0", input, err, sr.Pos())
+		}
+	}
+	vowels := &unicode.RangeTable{R16: []unicode.Range16{{Lo: 'a', Hi: 'a', Stride: 1}, {Lo: 'e', Hi: 'e', Stride: 1}}}
+	if _, err := Parse(RangeTable(vowels), "e"); err != nil {
+		t.Errorf("custom table: %v", err)
+	}
+}
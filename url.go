@@ -0,0 +1,71 @@
+package stateparser
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+func unhex(r rune) (byte, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return byte(r - '0'), true
+	case r >= 'a' && r <= 'f':
+		return byte(r - 'a' + 10), true
+	case r >= 'A' && r <= 'F':
+		return byte(r - 'A' + 10), true
+	}
+	return 0, false
+}
+
+func percentDecoded(stop func(rune) bool, plusAsSpace bool) Grammar {
+	return func(sr StateReader) (interface{}, error) {
+		start := sr.State()
+		buf := []byte{}
+		for {
+			state := sr.State()
+			r, _, err := sr.ReadRune()
+			if _, isFE := err.(fatalError); isFE {
+				return nil, err
+			}
+			if err != nil || stop(r) {
+				sr.RestoreState(state)
+				return string(buf), nil
+			}
+			switch {
+			case r == '%':
+				var b byte
+				for i := 0; i < 2; i++ {
+					h, _, err := sr.ReadRune()
+					if _, isFE := err.(fatalError); isFE {
+						return nil, err
+					}
+					d, ok := unhex(h)
+					if err != nil || !ok {
+						sr.RestoreState(start)
+						return nil, fmt.Errorf("Malformed percent escape")
+					}
+					b = b<<4 | d
+				}
+				buf = append(buf, b)
+			case r == '+' && plusAsSpace:
+				buf = append(buf, ' ')
+			default:
+				var enc [utf8.UTFMax]byte
+				buf = append(buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+			}
+		}
+	}
+}
+
+// PercentDecoded reads runes up to (but not including) the first one for
+// which stop returns true, or the end of input, decoding %XX escapes into the
+// bytes they encode. A '%' not followed by two hex digits is an error.
+func PercentDecoded(stop func(rune) bool) Grammar {
+	return percentDecoded(stop, false)
+}
+
+// FormDecoded is like PercentDecoded but also decodes '+' as a space, as in
+// application/x-www-form-urlencoded query strings.
+func FormDecoded(stop func(rune) bool) Grammar {
+	return percentDecoded(stop, true)
+}
@@ -0,0 +1,34 @@
+package stateparser
+
+import (
+	"testing"
+)
+
+func TestPercentDecoded(t *testing.T) {
+	amp := func(r rune) bool { return r == '&' }
+	tests := []struct {
+		g           Grammar
+		input, want string
+		pos         int
+	}{
+		{PercentDecoded(amp), "hello%20world&x", "hello world", 13},
+		{PercentDecoded(amp), "a%2Bb", "a+b", 5},
+		{PercentDecoded(amp), "a+b", "a+b", 3},
+		{PercentDecoded(amp), "%e4%b8%96&", "世", 9},
+		{PercentDecoded(amp), "&", "", 0},
+		{FormDecoded(amp), "a+b%2B&", "a b+", 6},
+	}
+	for _, tt := range tests {
+		sr := NewStringReader(tt.input)
+		m, err := tt.g(sr)
+		if err != nil || m != tt.want || sr.Pos() != tt.pos {
+			t.Errorf("on %q = %q, %v up to %d, want %q up to %d", tt.input, m, err, sr.Pos(), tt.want, tt.pos)
+		}
+	}
+	for _, input := range []string{"a%2", "a%", "a%zz", "%2&"} {
+		sr := NewStringReader(input)
+		if m, err := PercentDecoded(amp)(sr); err == nil || sr.Pos() != 0 {
+			t.Errorf("on %q = %q, %v at %d, want failure at 0", input, m, err, sr.Pos())
+		}
+	}
+}